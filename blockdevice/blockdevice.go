@@ -0,0 +1,253 @@
+package blockdevice
+
+import (
+	"albert_go_sim/device"
+	"fmt"
+	"os"
+)
+
+// Register addresses within the chip select
+const (
+	sectorLowAddress      = 0
+	sectorHighAddress     = 1
+	bufferSegmentAddress  = 2
+	bufferOffsetAddress   = 3
+	commandAddress        = 4
+	statusAddress         = 5
+	errorAddress          = 6
+	numSectorsLowAddress  = 7
+	numSectorsHighAddress = 8
+)
+
+// Commands written to the command register
+const (
+	ReadCommand  = 1
+	WriteCommand = 2
+)
+
+// Status register bits.  Done and Error are sticky;
+// write a 1 to the bit in the status register to clear it.
+const (
+	StatusBusy  = 0x0001
+	StatusDone  = 0x0002
+	StatusError = 0x0004
+)
+
+// Error codes found in the error register after StatusError is set
+const (
+	ErrorNone           = 0
+	ErrorBadSector      = 1
+	ErrorReadOnly       = 2
+	ErrorIO             = 3
+	ErrorUnknownCommand = 4
+	ErrorBusy           = 5
+)
+
+const (
+	// SectorSize is the number of 16 bit words in a sector.
+	// Words are stored big endian in the image file.
+	SectorSize       = 256
+	ticksPerTransfer = 4000
+	addressMask      = 0xFFFFF
+)
+
+// BlockDevice is a memory mapped, DMA style disk backed by a host image file.
+// Requires ReadMemory and WriteMemory to be set so the device can
+// move sectors to and from memory without the cpu.
+type BlockDevice struct {
+	image         *os.File
+	readOnly      bool
+	numSectors    uint32
+	sector        uint32
+	bufferSegment uint16
+	bufferOffset  uint16
+	command       uint16
+	status        uint16
+	errorCode     uint16
+	ticksLeft     int
+
+	ReadMemory  func(address uint32) uint16
+	WriteMemory func(address uint32, value uint16)
+}
+
+// Init opens the image file.  Its size must be a whole number of sectors.
+func (b *BlockDevice) Init(fileName string, readOnly bool) error {
+	fmt.Printf("Initializing block device with image %s\n", fileName)
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(fileName, flag, 0)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fileInfo.Size()%(SectorSize*2) != 0 {
+		f.Close()
+		return fmt.Errorf("block device image %s size %d is not a multiple of %d", fileName, fileInfo.Size(), SectorSize*2)
+	}
+	b.image = f
+	b.readOnly = readOnly
+	b.numSectors = uint32(fileInfo.Size() / (SectorSize * 2))
+	return nil
+}
+
+// Reset abandons any transfer in progress and clears the registers
+func (b *BlockDevice) Reset() {
+	b.sector = 0
+	b.bufferSegment = 0
+	b.bufferOffset = 0
+	b.command = 0
+	b.status = 0
+	b.errorCode = ErrorNone
+	b.ticksLeft = 0
+}
+
+// Tick should be called on every tick off the virtual clock
+// A transfer takes ticksPerTransfer ticks; the whole sector
+// is moved at the end.
+func (b *BlockDevice) Tick() {
+	if b.status&StatusBusy == 0 {
+		return
+	}
+	b.ticksLeft--
+	if b.ticksLeft > 0 {
+		return
+	}
+	b.transfer()
+}
+
+// transfer does the actual work of the current command
+func (b *BlockDevice) transfer() {
+	b.status &^= StatusBusy
+
+	if b.sector >= b.numSectors {
+		b.fail(ErrorBadSector)
+		return
+	}
+
+	address := (uint32(b.bufferSegment)<<4 + uint32(b.bufferOffset)) & addressMask
+	data := make([]byte, SectorSize*2)
+	position := int64(b.sector) * SectorSize * 2
+
+	if b.command == ReadCommand {
+		if _, err := b.image.ReadAt(data, position); err != nil {
+			b.fail(ErrorIO)
+			return
+		}
+		for i := 0; i < SectorSize; i++ {
+			b.WriteMemory(address, uint16(data[2*i])<<8|uint16(data[2*i+1]))
+			address = (address + 1) & addressMask
+		}
+		b.status |= StatusDone
+		return
+	}
+
+	if b.command == WriteCommand {
+		if b.readOnly {
+			b.fail(ErrorReadOnly)
+			return
+		}
+		for i := 0; i < SectorSize; i++ {
+			w := b.ReadMemory(address)
+			data[2*i] = byte(w >> 8)
+			data[2*i+1] = byte(w)
+			address = (address + 1) & addressMask
+		}
+		if _, err := b.image.WriteAt(data, position); err != nil {
+			b.fail(ErrorIO)
+			return
+		}
+		b.status |= StatusDone
+		return
+	}
+
+	b.fail(ErrorUnknownCommand)
+}
+
+// fail completes the current command with an error
+func (b *BlockDevice) fail(errorCode uint16) {
+	b.status &^= StatusBusy
+	b.status |= StatusDone | StatusError
+	b.errorCode = errorCode
+}
+
+// Read takes address and returns a value
+// Addresses are defined above
+func (b *BlockDevice) Read(address uint32) uint16 {
+	switch address {
+	case sectorLowAddress:
+		return uint16(b.sector)
+	case sectorHighAddress:
+		return uint16(b.sector >> 16)
+	case bufferSegmentAddress:
+		return b.bufferSegment
+	case bufferOffsetAddress:
+		return b.bufferOffset
+	case commandAddress:
+		return b.command
+	case statusAddress:
+		return b.status
+	case errorAddress:
+		return b.errorCode
+	case numSectorsLowAddress:
+		return uint16(b.numSectors)
+	case numSectorsHighAddress:
+		return uint16(b.numSectors >> 16)
+	}
+	fmt.Printf("WARNING tried to read unmapped block device address %02X\n", address)
+	return 0
+}
+
+// Write takes an address and a value
+// Writing the command register starts a transfer.
+func (b *BlockDevice) Write(address uint32, value uint16) {
+	// Registers may not change under a transfer in progress
+	if b.status&StatusBusy != 0 && address != statusAddress {
+		b.fail(ErrorBusy)
+		return
+	}
+
+	switch address {
+	case sectorLowAddress:
+		b.sector = b.sector&0xFFFF0000 | uint32(value)
+	case sectorHighAddress:
+		b.sector = b.sector&0x0000FFFF | uint32(value)<<16
+	case bufferSegmentAddress:
+		b.bufferSegment = value
+	case bufferOffsetAddress:
+		b.bufferOffset = value
+	case commandAddress:
+		b.command = value
+		b.errorCode = ErrorNone
+		b.status &^= StatusDone | StatusError
+		b.status |= StatusBusy
+		b.ticksLeft = ticksPerTransfer
+	case statusAddress:
+		b.status &^= value & (StatusDone | StatusError)
+	default:
+		fmt.Printf("WARNING tried to write unmapped block device address %02X\n", address)
+	}
+}
+
+// IsDone is a callback meant for use by an interrupt controller
+// It stays asserted until StatusDone is cleared.
+func (b *BlockDevice) IsDone() bool {
+	return b.status&StatusDone != 0
+}
+
+// Name returns the name of the device
+func (b *BlockDevice) Name() string {
+	return "Block Device"
+}
+
+// Interrupts returns the block device's interrupt outputs
+func (b *BlockDevice) Interrupts() []device.Interrupt {
+	return []device.Interrupt{
+		{Name: "IsDone", Asserted: b.IsDone},
+	}
+}
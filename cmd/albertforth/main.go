@@ -0,0 +1,85 @@
+// albertforth compiles Forth source to a V4 image and a map of its symbols
+//
+//	albertforth -o prog.v4 -map prog.map prog.fs ...
+package main
+
+import (
+	"albert_go_sim/forth"
+	"albert_go_sim/object"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	outFile := flag.String("o", "a.v4", "V4 file to write")
+	mapFile := flag.String("map", "", "map file (symbols) to write")
+	codeAddress := flag.String("code", "0400", "code load address (in hex)")
+	dataAddress := flag.String("data", "", "data load address (in hex); default is after the code")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Printf("usage: albertforth [flags] source...\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	options := object.Options{Entry: forth.StartSymbol}
+	n, err := strconv.ParseUint(*codeAddress, 16, 16)
+	if err != nil {
+		fmt.Printf("Invalid code address %q\n", *codeAddress)
+		os.Exit(2)
+	}
+	options.CodeAddress = uint16(n)
+	if *dataAddress != "" {
+		n, err := strconv.ParseUint(*dataAddress, 16, 16)
+		if err != nil {
+			fmt.Printf("Invalid data address %q\n", *dataAddress)
+			os.Exit(2)
+		}
+		options.DataAddress = uint16(n)
+		options.IsDataAddressSet = true
+	}
+
+	// The source files are compiled as one program
+	var source strings.Builder
+	for _, fileName := range flag.Args() {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		source.Write(data)
+		source.WriteString("\n")
+	}
+	o, err := forth.Compile(source.String(), flag.Arg(0))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	image, linkMap, err := object.Link([]*object.Object{o}, options)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if err := image.WriteFile(*outFile); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if *mapFile != "" {
+		f, err := os.Create(*mapFile)
+		if err == nil {
+			err = linkMap.Write(f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// albertlink links relocatable albert object files into a V4 image
+//
+//	albertlink -o prog.v4 -map prog.map -code 0400 a.ao b.ao ...
+package main
+
+import (
+	"albert_go_sim/object"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func main() {
+	outFile := flag.String("o", "a.v4", "V4 file to write")
+	mapFile := flag.String("map", "", "map file to write")
+	codeAddress := flag.String("code", "0400", "code load address (in hex)")
+	dataAddress := flag.String("data", "", "data load address (in hex); default is after the code")
+	entry := flag.String("entry", "", "entry symbol; default is the entry given by the objects")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Printf("usage: albertlink [flags] object...\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	var options object.Options
+	n, err := strconv.ParseUint(*codeAddress, 16, 16)
+	if err != nil {
+		fmt.Printf("Invalid code address %q\n", *codeAddress)
+		os.Exit(2)
+	}
+	options.CodeAddress = uint16(n)
+	if *dataAddress != "" {
+		n, err := strconv.ParseUint(*dataAddress, 16, 16)
+		if err != nil {
+			fmt.Printf("Invalid data address %q\n", *dataAddress)
+			os.Exit(2)
+		}
+		options.DataAddress = uint16(n)
+		options.IsDataAddressSet = true
+	}
+	options.Entry = *entry
+
+	var objects []*object.Object
+	for _, fileName := range flag.Args() {
+		o, err := object.ReadFile(fileName)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		objects = append(objects, o)
+	}
+
+	image, linkMap, err := object.Link(objects, options)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if err := image.WriteFile(*outFile); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if *mapFile != "" {
+		f, err := os.Create(*mapFile)
+		if err == nil {
+			err = linkMap.Write(f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+}
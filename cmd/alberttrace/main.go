@@ -0,0 +1,275 @@
+// alberttrace pretty prints, filters and compares execution traces
+// written by the simulator's -trace flag or T and t menu entries
+//
+//	alberttrace print [-addr 0400-04FF] [-op JSR,RET] [-limit n] trace
+//	alberttrace filter [-addr ...] [-op ...] [-format binary] -o out trace
+//	alberttrace diff [-max n] trace1 trace2
+package main
+
+import (
+	"albert_go_sim/cpu"
+	"albert_go_sim/trace"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// filter selects entries
+type filter struct {
+	addressRange string
+	opcodes      string
+	limit        int
+
+	low, high uint32
+	mnemonics map[string]bool
+}
+
+func (f *filter) addFlags(flags *flag.FlagSet) {
+	flags.StringVar(&f.addressRange, "addr", "", "only entries with an address in this range e.g. 0400-04FF (hex)")
+	flags.StringVar(&f.opcodes, "op", "", "only entries with one of these comma separated mnemonics e.g. JSR,RET")
+	flags.IntVar(&f.limit, "limit", 0, "stop after this many matching entries (0 = no limit)")
+}
+
+// parse checks the flag values
+func (f *filter) parse() error {
+	f.low, f.high = 0, 0xFFFFFFFF
+	if f.addressRange != "" {
+		parts := strings.SplitN(f.addressRange, "-", 2)
+		low, err := strconv.ParseUint(parts[0], 16, 32)
+		if err != nil {
+			return fmt.Errorf("invalid address range %q", f.addressRange)
+		}
+		high := low
+		if len(parts) == 2 {
+			if high, err = strconv.ParseUint(parts[1], 16, 32); err != nil {
+				return fmt.Errorf("invalid address range %q", f.addressRange)
+			}
+		}
+		f.low, f.high = uint32(low), uint32(high)
+	}
+	if f.opcodes != "" {
+		f.mnemonics = make(map[string]bool)
+		for _, name := range strings.Split(strings.ToUpper(f.opcodes), ",") {
+			if _, ok := cpu.Opcode(name); !ok {
+				return fmt.Errorf("unknown mnemonic %s", name)
+			}
+			f.mnemonics[name] = true
+		}
+	}
+	return nil
+}
+
+// matches reports whether e is selected
+func (f *filter) matches(e *trace.Entry) bool {
+	if e.Address < f.low || e.Address > f.high {
+		return false
+	}
+	return f.mnemonics == nil || f.mnemonics[cpu.Mnemonic(e.Opcode)]
+}
+
+// each calls fn for every selected entry of the trace in fileName
+func (f *filter) each(fileName string, fn func(e *trace.Entry) error) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := trace.NewReader(file)
+	if err != nil {
+		return err
+	}
+	numMatched := 0
+	for f.limit == 0 || numMatched < f.limit {
+		e, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", fileName, err)
+		}
+		if !f.matches(e) {
+			continue
+		}
+		numMatched++
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// format returns one line describing e
+func format(e *trace.Entry) string {
+	return fmt.Sprintf("%8d %05X  %-10s %04X | PSTACK => %04X %04X %04X PTOS:%04X  RSTACK => %04X %04X %04X RTOS:%04X | PSP:%04X RSP:%04X CS:%04X DS:%04X ES:%04X F:%02X",
+		e.Seq, e.Address, cpu.Mnemonic(e.Opcode), e.Inline,
+		e.PStack[3], e.PStack[2], e.PStack[1], e.PStack[0],
+		e.RStack[3], e.RStack[2], e.RStack[1], e.RStack[0],
+		e.PSP, e.RSP, e.CS, e.DS, e.ES, e.Flags)
+}
+
+func printTrace(args []string) error {
+	var f filter
+	flags := flag.NewFlagSet("print", flag.ExitOnError)
+	f.addFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: alberttrace print [flags] trace")
+	}
+	if err := f.parse(); err != nil {
+		return err
+	}
+	return f.each(flags.Arg(0), func(e *trace.Entry) error {
+		fmt.Println(format(e))
+		return nil
+	})
+}
+
+func filterTrace(args []string) error {
+	var f filter
+	flags := flag.NewFlagSet("filter", flag.ExitOnError)
+	f.addFlags(flags)
+	outFile := flags.String("o", "", "trace file to write")
+	outFormat := flags.String("format", trace.JSONLFormat, "format to write: jsonl or binary")
+	flags.Parse(args)
+	if flags.NArg() != 1 || *outFile == "" {
+		return fmt.Errorf("usage: alberttrace filter [flags] -o out trace")
+	}
+	if err := f.parse(); err != nil {
+		return err
+	}
+
+	out, err := os.Create(*outFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, err := trace.NewWriter(out, *outFormat)
+	if err != nil {
+		return err
+	}
+	err = f.each(flags.Arg(0), func(e *trace.Entry) error {
+		e.Mnemonic = cpu.Mnemonic(e.Opcode)
+		return writer.Write(e)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// differences lists the fields (other than Seq) which differ
+func differences(a *trace.Entry, b *trace.Entry) []string {
+	var d []string
+	field := func(name string, x, y interface{}) {
+		if x != y {
+			d = append(d, fmt.Sprintf("%s %X vs %X", name, x, y))
+		}
+	}
+	field("address", a.Address, b.Address)
+	field("opcode", a.Opcode, b.Opcode)
+	field("inline", a.Inline, b.Inline)
+	field("pstack", a.PStack, b.PStack)
+	field("rstack", a.RStack, b.RStack)
+	field("pc", a.PC, b.PC)
+	field("psp", a.PSP, b.PSP)
+	field("rsp", a.RSP, b.RSP)
+	field("cs", a.CS, b.CS)
+	field("ds", a.DS, b.DS)
+	field("es", a.ES, b.ES)
+	field("flags", a.Flags, b.Flags)
+	return d
+}
+
+// diffTraces compares two traces entry by entry.
+// It returns true if they are the same.
+func diffTraces(args []string) (bool, error) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	maxDifferences := flags.Int("max", 10, "stop after this many differing entries (0 = no limit)")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return false, fmt.Errorf("usage: alberttrace diff [flags] trace1 trace2")
+	}
+	if *maxDifferences < 0 {
+		return false, fmt.Errorf("-max %d is negative", *maxDifferences)
+	}
+
+	var readers [2]*trace.Reader
+	for i := range readers {
+		file, err := os.Open(flags.Arg(i))
+		if err != nil {
+			return false, err
+		}
+		defer file.Close()
+		if readers[i], err = trace.NewReader(file); err != nil {
+			return false, err
+		}
+	}
+	return diffReaders(os.Stdout, [2]string{flags.Arg(0), flags.Arg(1)}, readers, *maxDifferences)
+}
+
+// diffReaders writes the differences between the traces read by
+// readers to w, stopping after maxDifferences (0 = no limit).
+// names are used in messages.  It returns true if they are the same.
+func diffReaders(w io.Writer, names [2]string, readers [2]*trace.Reader, maxDifferences int) (bool, error) {
+	numDifferent := 0
+	for i := 0; maxDifferences == 0 || numDifferent < maxDifferences; i++ {
+		a, errA := readers[0].Read()
+		b, errB := readers[1].Read()
+		if errA != nil && errA != io.EOF {
+			return false, fmt.Errorf("%s: %v", names[0], errA)
+		}
+		if errB != nil && errB != io.EOF {
+			return false, fmt.Errorf("%s: %v", names[1], errB)
+		}
+		if errA == io.EOF || errB == io.EOF {
+			if errA != errB {
+				shorter := names[0]
+				if errB == io.EOF {
+					shorter = names[1]
+				}
+				fmt.Fprintf(w, "%s ends after %d entries\n", shorter, i)
+				numDifferent++
+			}
+			break
+		}
+		if d := differences(a, b); len(d) != 0 {
+			fmt.Fprintf(w, "entry %d: %s\n", i, strings.Join(d, ", "))
+			fmt.Fprintf(w, "  < %s\n  > %s\n", format(a), format(b))
+			numDifferent++
+		}
+	}
+	return numDifferent == 0, nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Printf("usage: alberttrace print|filter|diff [flags] trace...\n")
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "print":
+		err = printTrace(os.Args[2:])
+	case "filter":
+		err = filterTrace(os.Args[2:])
+	case "diff":
+		var isSame bool
+		isSame, err = diffTraces(os.Args[2:])
+		if err == nil && !isSame {
+			os.Exit(1)
+		}
+	default:
+		err = fmt.Errorf("unknown command %s; expected print, filter or diff", os.Args[1])
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(2)
+	}
+}
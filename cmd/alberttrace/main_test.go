@@ -0,0 +1,74 @@
+package main
+
+import (
+	"albert_go_sim/trace"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// jsonlTrace returns a trace with an entry for each pc
+func jsonlTrace(t *testing.T, pcs ...uint16) *trace.Reader {
+	var b bytes.Buffer
+	w, err := trace.NewWriter(&b, trace.JSONLFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pc := range pcs {
+		if err := w.Write(&trace.Entry{Seq: uint64(i), PC: pc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := trace.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDiffReaders(t *testing.T) {
+	tests := []struct {
+		name           string
+		a, b           []uint16
+		maxDifferences int
+		wantSame       bool
+		wantReported   int // lines starting "entry" or ending "entries"
+	}{
+		{"same", []uint16{1, 2, 3}, []uint16{1, 2, 3}, 10, true, 0},
+		{"same with no limit", []uint16{1, 2, 3}, []uint16{1, 2, 3}, 0, true, 0},
+		{"different with no limit", []uint16{1, 2, 3}, []uint16{1, 5, 6}, 0, false, 2},
+		{"stops at max", []uint16{1, 2, 3}, []uint16{4, 5, 6}, 2, false, 2},
+		{"first is shorter", []uint16{1, 2}, []uint16{1, 2, 3}, 0, false, 1},
+		{"second is shorter", []uint16{1, 2, 3}, []uint16{1}, 10, false, 1},
+		{"both empty", nil, nil, 0, true, 0},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		readers := [2]*trace.Reader{jsonlTrace(t, test.a...), jsonlTrace(t, test.b...)}
+		isSame, err := diffReaders(&out, [2]string{"a", "b"}, readers, test.maxDifferences)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if isSame != test.wantSame {
+			t.Errorf("%s: same is %v; want %v", test.name, isSame, test.wantSame)
+		}
+		numReported := 0
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(line, "entry ") || strings.HasSuffix(line, " entries") {
+				numReported++
+			}
+		}
+		if numReported != test.wantReported {
+			t.Errorf("%s: %d differences reported; want %d\n%s", test.name, numReported, test.wantReported, out.String())
+		}
+	}
+}
+
+func TestDiffRejectsNegativeMax(t *testing.T) {
+	if _, err := diffTraces([]string{"-max", "-1", "a", "b"}); err == nil {
+		t.Errorf("-max -1 was accepted")
+	}
+}
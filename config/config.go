@@ -0,0 +1,273 @@
+// Package config reads a JSON machine description.  It says which
+// devices are present, at which chip select, how serial ports are
+// connected, how interrupt outputs are wired to the interrupt
+// controller and how fast the clock runs.  See machine.json for
+// a description of the default machine.
+package config
+
+import (
+	"albert_go_sim/memory"
+	"albert_go_sim/rom"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Device types
+const (
+	SerialType      = "serial"
+	CounterType     = "counter"
+	TimerType       = "timer"
+	RTCType         = "rtc"
+	BlockDeviceType = "blockdevice"
+)
+
+// Defaults for settings left out of the description
+const (
+	DefaultClockFrequency = 10000000
+	DefaultInterruptCS    = "F010"
+)
+
+const (
+	numInterruptInputs     = 16
+	firstDeviceChipSelect  = 0xF000
+	lastDeviceChipSelect   = 0xF0D0
+	deviceChipSelectStride = 0x10
+)
+
+// Serial port backends
+const (
+	TCPBackend = "tcp"
+)
+
+// Clock settings
+type Clock struct {
+	Frequency int  `json:"frequency"`
+	Print     bool `json:"print"`
+}
+
+// ROM settings.  When File is empty the built in loader is used.
+// Format is one of "hex", "binary", "v4" or empty to guess.
+type ROM struct {
+	File   string `json:"file"`
+	Format string `json:"format"`
+}
+
+// InterruptController settings
+type InterruptController struct {
+	ChipSelect string `json:"chipSelect"`
+}
+
+// Device describes one device.  Which fields matter depends on Type.
+type Device struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	ChipSelect string `json:"chipSelect"`
+
+	// serial
+	Backend      string `json:"backend"`
+	TCPPort      int    `json:"tcpPort"`
+	Telnet       bool   `json:"telnet"`
+	ObserverPort int    `json:"observerPort"`
+
+	// blockdevice
+	Image    string `json:"image"`
+	ReadOnly bool   `json:"readOnly"`
+
+	// rtc (SimulatedStart is RFC 3339 e.g. "2024-01-01T00:00:00Z")
+	SimulatedStart string `json:"simulatedStart"`
+	TicksPerSecond uint64 `json:"ticksPerSecond"`
+
+	// Interrupts maps the device's interrupt output names
+	// e.g. "RXIsNotEmpty" to interrupt controller inputs
+	Interrupts map[string]int `json:"interrupts"`
+}
+
+// Machine is the whole machine description
+type Machine struct {
+	Clock               Clock               `json:"clock"`
+	ROM                 ROM                 `json:"rom"`
+	InterruptController InterruptController `json:"interruptController"`
+	Devices             []Device            `json:"devices"`
+}
+
+// Load reads and validates a machine description
+func Load(fileName string) (*Machine, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m Machine
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	if m.Clock.Frequency == 0 {
+		m.Clock.Frequency = DefaultClockFrequency
+	}
+	if m.InterruptController.ChipSelect == "" {
+		m.InterruptController.ChipSelect = DefaultInterruptCS
+	}
+	for i := range m.Devices {
+		if m.Devices[i].Name == "" {
+			m.Devices[i].Name = fmt.Sprintf("%s%d", m.Devices[i].Type, i)
+		}
+		if m.Devices[i].Type == SerialType && m.Devices[i].Backend == "" {
+			m.Devices[i].Backend = TCPBackend
+		}
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return &m, nil
+}
+
+// ParseChipSelect turns a chip select such as "F090" into
+// the memory package constant (e.g. memory.F090)
+func ParseChipSelect(s string) (int, error) {
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || n < firstDeviceChipSelect || n > lastDeviceChipSelect || n%deviceChipSelectStride != 0 {
+		return 0, fmt.Errorf("chip select %q is not one of F000, F010 ... F0D0", s)
+	}
+	return memory.F000 + int(n-firstDeviceChipSelect)/deviceChipSelectStride, nil
+}
+
+// Validate checks the description for missing settings and
+// conflicts such as two devices on one chip select.
+// All problems are reported, not just the first.
+func (m *Machine) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if m.Clock.Frequency < 0 {
+		problem("clock frequency %d must be positive", m.Clock.Frequency)
+	}
+
+	switch m.ROM.Format {
+	case "", rom.HexFormat, rom.BinaryFormat, rom.V4Format:
+	default:
+		problem("rom: unknown format %q", m.ROM.Format)
+	}
+
+	chipSelects := make(map[int]string)
+	if cs, err := ParseChipSelect(m.InterruptController.ChipSelect); err != nil {
+		problem("interrupt controller: %v", err)
+	} else {
+		chipSelects[cs] = "interrupt controller"
+	}
+
+	names := make(map[string]bool)
+	tcpPorts := make(map[int]string)
+	useTCPPort := func(owner string, port int) {
+		if port <= 0 || port > 65535 {
+			problem("%s: TCP port %d is not valid", owner, port)
+			return
+		}
+		if other, ok := tcpPorts[port]; ok {
+			problem("%s: TCP port %d is already used by %s", owner, port, other)
+			return
+		}
+		tcpPorts[port] = owner
+	}
+	interruptLines := make(map[int]string)
+
+	for _, d := range m.Devices {
+		owner := fmt.Sprintf("device %q", d.Name)
+
+		if names[d.Name] {
+			problem("%s: name is used more than once", owner)
+		}
+		names[d.Name] = true
+
+		if d.ChipSelect != "" {
+			cs, err := ParseChipSelect(d.ChipSelect)
+			if err != nil {
+				problem("%s: %v", owner, err)
+			} else if other, ok := chipSelects[cs]; ok {
+				problem("%s: chip select %s is already used by %s", owner, d.ChipSelect, other)
+			} else {
+				chipSelects[cs] = owner
+			}
+		}
+
+		switch d.Type {
+		case SerialType:
+			if d.ChipSelect == "" {
+				problem("%s: a serial port needs a chip select", owner)
+			}
+			switch d.Backend {
+			case TCPBackend:
+				useTCPPort(owner, d.TCPPort)
+			default:
+				problem("%s: unknown serial backend %q", owner, d.Backend)
+			}
+			if d.Backend != TCPBackend && d.Telnet {
+				problem("%s: telnet is only for the tcp backend", owner)
+			}
+			if d.Backend != TCPBackend && d.ObserverPort != 0 {
+				problem("%s: observerPort is only for the tcp backend", owner)
+			} else if d.ObserverPort != 0 {
+				useTCPPort(owner+" observers", d.ObserverPort)
+			}
+		case CounterType:
+		case TimerType:
+			if d.ChipSelect == "" {
+				problem("%s: a timer needs a chip select", owner)
+			}
+		case RTCType:
+			if d.ChipSelect == "" {
+				problem("%s: an rtc needs a chip select", owner)
+			}
+			if d.SimulatedStart != "" && d.TicksPerSecond == 0 {
+				problem("%s: simulatedStart needs a ticksPerSecond greater than 0", owner)
+			}
+			if _, err := time.Parse(time.RFC3339, d.SimulatedStart); d.SimulatedStart != "" && err != nil {
+				problem("%s: simulatedStart: %v", owner, err)
+			}
+		case BlockDeviceType:
+			if d.Image == "" {
+				problem("%s: a block device needs an image", owner)
+			}
+			if d.ChipSelect == "" {
+				problem("%s: a block device needs a chip select", owner)
+			}
+		default:
+			problem("%s: unknown type %q", owner, d.Type)
+		}
+
+		var interruptNames []string
+		for name := range d.Interrupts {
+			interruptNames = append(interruptNames, name)
+		}
+		sort.Strings(interruptNames)
+		for _, name := range interruptNames {
+			line := d.Interrupts[name]
+			if line < 0 || line >= numInterruptInputs {
+				problem("%s: interrupt %s line %d is not between 0 and %d", owner, name, line, numInterruptInputs-1)
+				continue
+			}
+			if other, ok := interruptLines[line]; ok {
+				problem("%s: interrupt line %d is already used by %s", owner, line, other)
+				continue
+			}
+			interruptLines[line] = owner + " " + name
+		}
+	}
+
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
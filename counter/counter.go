@@ -1,6 +1,7 @@
 package counter
 
 import (
+	"albert_go_sim/device"
 	"albert_go_sim/intmaxmin"
 	"fmt"
 	"runtime"
@@ -38,12 +39,30 @@ func (c *Counter) CounterIsZero() bool {
 }
 
 // Read ignores address and returns the value of the counter
-func (c *Counter) Read(address uint16) uint16 {
+func (c *Counter) Read(address uint32) uint16 {
 	return c.value
 }
 
 // Write for the counter doesn't make sense; flag as simulation WARNING
-func (c *Counter) Write(address uint16, value uint16) {
+func (c *Counter) Write(address uint32, value uint16) {
 	fmt.Printf("WARNING tried to write to read only counter\n")
 	runtime.Goexit()
 }
+
+// Name returns the name of the device
+func (c *Counter) Name() string {
+	return "Counter"
+}
+
+// Reset sets the counter back to zero
+func (c *Counter) Reset() {
+	c.value = 0
+	c.tickNum = 0
+}
+
+// Interrupts returns the counter's interrupt outputs
+func (c *Counter) Interrupts() []device.Interrupt {
+	return []device.Interrupt{
+		{Name: "CounterIsZero", Asserted: c.CounterIsZero},
+	}
+}
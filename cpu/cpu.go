@@ -84,7 +84,7 @@ const (
 )
 
 // History contains the run time history of the CPU
-var History tHistory
+var History = newHistory(DefaultHistorySize)
 
 // CPU struct matches hardware
 type CPU struct {
@@ -105,6 +105,11 @@ type CPU struct {
 	ReadCodeMemory            func(address uint32) uint16
 	history                   []Status
 	InterruptCallback         func() bool
+	InterruptAcknowledge      func() uint16
+	InterruptTaken            func()
+	InterruptReturned         func()
+	PeekMemory                func(address uint32) uint16
+	instructionAddress        uint32
 	tickNum                   int
 	breakPoints               map[uint32]bool
 	previousBreakPointAddress uint32
@@ -164,6 +169,26 @@ func (c *CPU) ShowBreakPoints() {
 	}
 }
 
+// InterruptsEnabled returns true when the cpu will respond to interrupts
+func (c *CPU) InterruptsEnabled() bool {
+	return c.IntCtlLow&0x01 == 1
+}
+
+// InstructionAddress returns the absolute address of the
+// instruction being (or last) executed
+func (c *CPU) InstructionAddress() uint32 {
+	return c.instructionAddress
+}
+
+// peek reads memory for the history snapshot.  PeekMemory (optional)
+// reads without appearing in the memory access trace.
+func (c *CPU) peek(address uint32) uint16 {
+	if c.PeekMemory != nil {
+		return c.PeekMemory(address)
+	}
+	return c.ReadDataMemory(address)
+}
+
 // SetPC allows direct setting of the the cpu's PC
 func (c *CPU) SetPC(pc uint16) {
 	c.PC = pc
@@ -230,6 +255,7 @@ func (c *CPU) Tick() int {
 
 	// var absoluteAddress uint32 = uint32(c.CS<<4 + c.PC)
 	absoluteAddress := uint32(c.CS)<<4 + uint32(c.PC)
+	c.instructionAddress = absoluteAddress
 
 	if c.InterruptCallback() && ((c.IntCtlLow & 0x01) == 1) {
 		// Notice the PC has not been incremented.
@@ -270,24 +296,25 @@ func (c *CPU) doInstruction(opCode uint16, absoluteAddress uint32) int {
 	var pstackBuffer [4]uint16
 	for i := uint32(3); i > 0; i-- {
 		address := scaledDS + uint32(c.PSP) - i
-		pstackBuffer[i] = c.ReadDataMemory(address)
+		pstackBuffer[i] = c.peek(address)
 	}
 	pstackBuffer[0] = c.PTOS
 
 	var rstackBuffer [4]uint16
 	for i := uint32(3); i > 0; i-- {
 		address := scaledDS + uint32(c.RSP) - i
-		rstackBuffer[i] = c.ReadDataMemory(address)
+		rstackBuffer[i] = c.peek(address)
 	}
 	rstackBuffer[0] = c.RTOS
 
 	// Create a bunch of short cut names for uuse witth the  disasembbly
-	leftOperand := c.ReadDataMemory(scaledDS + uint32(c.PSP) - 1)
+	leftOperand := c.peek(scaledDS + uint32(c.PSP) - 1)
 	rightOperand := c.PTOS
-	inlineOperand := c.ReadDataMemory(scaledCS + uint32(c.PC))
+	inlineOperand := c.peek(scaledCS + uint32(c.PC))
 
 	snapShot.absoluteAddress = absoluteAddress
-	snapShot.cpuStruct = *c
+	snapShot.pcOperand = c.PC
+	snapShot.flagsOperand = c.IntCtlLow
 	snapShot.pStack = pstackBuffer
 	snapShot.rStack = rstackBuffer
 	snapShot.opCode = opCode
@@ -470,7 +497,14 @@ func (c *CPU) doInstruction(opCode uint16, absoluteAddress uint32) int {
 
 	// JSRINT
 	// rPush sequence should match rPop sequene in RETI
+	// The ISR address is 0xFD00 unless InterruptAcknowledge
+	// (an optional interrupt controller callback) says otherwise.
+	// InterruptTaken and InterruptReturned are optional callbacks
+	// used for interrupt statistics.
 	if opCode == jsrintOpcode {
+		if c.InterruptTaken != nil {
+			c.InterruptTaken()
+		}
 		tmpRSP := c.RSP
 		tmpRTOS := c.RTOS
 		c.rPush(c.DS)
@@ -485,6 +519,9 @@ func (c *CPU) doInstruction(opCode uint16, absoluteAddress uint32) int {
 
 		c.IntCtlLow = c.IntCtlLow & 0xFE
 		c.PC = 0xFD00
+		if c.InterruptAcknowledge != nil {
+			c.PC = c.InterruptAcknowledge()
+		}
 		c.CS = 0x0000
 
 		return Normal
@@ -508,6 +545,10 @@ func (c *CPU) doInstruction(opCode uint16, absoluteAddress uint32) int {
 		c.RSP = tmpRSP
 		c.RTOS = tmpRTOS
 
+		if c.InterruptReturned != nil {
+			c.InterruptReturned()
+		}
+
 		// fmt.Printf("DEBUG in RETI 9 values were popped:\n")
 		// c.ShowStatus()
 
@@ -2,12 +2,14 @@ package cpu
 
 import (
 	"albert_go_sim/intmaxmin"
+	"albert_go_sim/trace"
 	"fmt"
+	"io"
 )
 
-// Status contains a snapshot along with disassembly
+// Status contains a snapshot of the cpu as an instruction is executed.
+// It is kept small because the history holds a great many of them.
 type Status struct {
-	cpuStruct       CPU
 	absoluteAddress uint32
 	opCode          uint16
 	pStack          [4]uint16
@@ -18,71 +20,159 @@ type Status struct {
 	rtosOperand     uint16
 	pspOperand      uint16
 	rspOperand      uint16
-	ptosOperand     uint16
+	pcOperand       uint16
 	csOperand       uint16
 	dsOperand       uint16
 	esOperand       uint16
 	flagsOperand    uint8
 }
 
-const historySize = 1024 * 1024
+// DefaultHistorySize is the number of instructions remembered
+// unless SetSize is called
+const DefaultHistorySize = 1024 * 1024
 
+// tHistory is a ring of the most recent Status snapshots.
+// data is allocated when the first instruction is logged so
+// choosing a size costs nothing until the cpu runs.
 type tHistory struct {
-	data       [historySize]Status
-	numEntries int
-	nextIn     int
+	data        []Status
+	size        int
+	numEntries  int
+	nextIn      int
+	numLogged   uint64
+	traceWriter *trace.Writer
+}
+
+// newHistory returns a history remembering size instructions
+func newHistory(size int) *tHistory {
+	return &tHistory{size: size}
+}
+
+// SetSize changes the number of instructions remembered.
+// The history is cleared.
+func (h *tHistory) SetSize(size int) error {
+	if size < 1 {
+		return fmt.Errorf("history size %d must be at least 1", size)
+	}
+	h.size = size
+	h.data = nil
+	h.Clear()
+	return nil
+}
+
+// Size returns the number of instructions which can be remembered
+func (h *tHistory) Size() int {
+	return h.size
 }
 
 func (h *tHistory) logInstruction(s Status) {
+	if h.data == nil {
+		h.data = make([]Status, h.size)
+	}
 	h.data[h.nextIn] = s
-	h.nextIn = (h.nextIn + 1) % historySize
-	if h.numEntries < historySize {
+	h.nextIn = (h.nextIn + 1) % len(h.data)
+	if h.numEntries < len(h.data) {
 		h.numEntries++
 	}
+
+	if h.traceWriter != nil {
+		e := s.traceEntry(h.numLogged)
+		if err := h.traceWriter.Write(&e); err != nil {
+			fmt.Printf("WARNING could not write trace (%v); tracing stopped\n", err)
+			h.traceWriter = nil
+		}
+	}
+	h.numLogged++
 }
 
-// Clear wipes out history
-func (h *tHistory) Clear() {
-	h.numEntries = 0
-	h.nextIn = 0
+// traceEntry converts a snapshot to a trace entry
+func (s *Status) traceEntry(seq uint64) trace.Entry {
+	return trace.Entry{
+		Seq:      seq,
+		Address:  s.absoluteAddress,
+		Opcode:   s.opCode,
+		Inline:   s.inlineOperand,
+		Left:     s.leftOperand,
+		Right:    s.rightOperand,
+		PStack:   s.pStack,
+		RStack:   s.rStack,
+		PC:       s.pcOperand,
+		PSP:      s.pspOperand,
+		RSP:      s.rspOperand,
+		CS:       s.csOperand,
+		DS:       s.dsOperand,
+		ES:       s.esOperand,
+		Flags:    s.flagsOperand,
+		Mnemonic: Mnemonic(s.opCode),
+	}
 }
 
-// Display dumps numInstructions of the cpu history
-func (h *tHistory) Display(numInstructions int) {
-	numInstructions = intmaxmin.Constrain(numInstructions, 0, h.numEntries)
+// StartTrace streams every instruction from now on to w in format
+// (see the trace package) until StopTrace is called
+func (h *tHistory) StartTrace(w io.Writer, format string) error {
+	traceWriter, err := trace.NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+	h.traceWriter = traceWriter
+	return nil
+}
 
-	start := h.nextIn - numInstructions
-	if start < 0 {
-		start = len(h.data) - start
+// StopTrace stops streaming and flushes the trace
+func (h *tHistory) StopTrace() error {
+	if h.traceWriter == nil {
+		return nil
 	}
+	err := h.traceWriter.Flush()
+	h.traceWriter = nil
+	return err
+}
 
-	index := start
-	for i := 0; i < numInstructions; i++ {
+// IsTracing is true between StartTrace and StopTrace
+func (h *tHistory) IsTracing() bool {
+	return h.traceWriter != nil
+}
 
-		// absoluteAddress := h.data[index].absoluteAddress
-		// disassemblyString := h.data[index].disassemblyString
+// Export writes the whole history, oldest first, to w in format
+func (h *tHistory) Export(w io.Writer, format string) error {
+	traceWriter, err := trace.NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < h.numEntries; i++ {
+		e := h.entry(i).traceEntry(h.seq(i))
+		if err := traceWriter.Write(&e); err != nil {
+			return err
+		}
+	}
+	return traceWriter.Flush()
+}
 
-		// psp := h.data[index].cpuStruct.PSP
-		// rsp := h.data[index].cpuStruct.RSP
+// entry returns the i'th remembered instruction, oldest first
+func (h *tHistory) entry(i int) *Status {
+	return &h.data[(h.nextIn-h.numEntries+i+len(h.data))%len(h.data)]
+}
 
-		// p0 := h.data[index].pStack[0]
-		// p1 := h.data[index].pStack[1]
-		// p2 := h.data[index].pStack[2]
+// seq returns the sequence number (instructions since the
+// simulator started) of the i'th remembered instruction
+func (h *tHistory) seq(i int) uint64 {
+	return h.numLogged - uint64(h.numEntries-i)
+}
 
-		// r0 := h.data[index].rStack[0]
-		// r1 := h.data[index].rStack[1]
-		// r2 := h.data[index].rStack[2]
+// Clear wipes out history.  A trace in progress continues.
+func (h *tHistory) Clear() {
+	h.numEntries = 0
+	h.nextIn = 0
+}
 
-		// s := fmt.Sprintf("%08X  %25s PSP:%04X   PSTACK[%04X %04X %04X]  RSP:%04X  RSTACK[%04X %04X %04X]",
-		// 	absoluteAddress, disassemblyString, psp, p0, p1, p2,
-		// 	rsp, r0, r1, r2)
+// Display dumps numInstructions of the cpu history
+func (h *tHistory) Display(numInstructions int) {
+	numInstructions = intmaxmin.Constrain(numInstructions, 0, h.numEntries)
 
-		disassemblyString := createDisassemblyString(h.data[index])
+	for i := h.numEntries - numInstructions; i < h.numEntries; i++ {
+		disassemblyString := createDisassemblyString(*h.entry(i))
 		fmt.Println(disassemblyString)
-		index++
-		index = index % len(h.data)
 	}
-
 }
 
 // createDisassemblyString
@@ -0,0 +1,185 @@
+package cpu
+
+import (
+	"albert_go_sim/intmaxmin"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condition is true for the history entries a query selects
+type condition func(s *Status) bool
+
+// registers are the values a condition can compare
+var registers = map[string]func(s *Status) uint16{
+	"pc":    func(s *Status) uint16 { return s.pcOperand },
+	"psp":   func(s *Status) uint16 { return s.pspOperand },
+	"rsp":   func(s *Status) uint16 { return s.rspOperand },
+	"ptos":  func(s *Status) uint16 { return s.pStack[0] },
+	"rtos":  func(s *Status) uint16 { return s.rStack[0] },
+	"cs":    func(s *Status) uint16 { return s.csOperand },
+	"seg":   func(s *Status) uint16 { return s.csOperand },
+	"ds":    func(s *Status) uint16 { return s.dsOperand },
+	"es":    func(s *Status) uint16 { return s.esOperand },
+	"flags": func(s *Status) uint16 { return uint16(s.flagsOperand) },
+}
+
+// comparisons are the operators a register condition can use
+var comparisons = []struct {
+	operator string
+	compare  func(a, b uint16) bool
+}{
+	// != must be checked before =
+	{"!=", func(a, b uint16) bool { return a != b }},
+	{"=", func(a, b uint16) bool { return a == b }},
+	{"<", func(a, b uint16) bool { return a < b }},
+	{">", func(a, b uint16) bool { return a > b }},
+}
+
+// parseConditions turns text such as "addr=0400-04FF op=JSR,RET ptos=0005"
+// into a condition which is true when all of the terms are.
+// Terms are
+//
+//	addr=X or addr=LO-HI        absolute address of the instruction
+//	op=NAME,NAME...             mnemonic (see Mnemonic)
+//	REG=X REG!=X REG<X REG>X    REG is pc, psp, rsp, ptos, rtos,
+//	                            cs, ds, es, flags or seg (the same as cs)
+//
+// Numbers are hex.  Register values are those before the instruction
+// executed except pc which has already moved past the opcode.
+func parseConditions(text string) (condition, error) {
+	var terms []condition
+	for _, term := range strings.Fields(strings.ToLower(text)) {
+		c, err := parseTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, c)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("no conditions given")
+	}
+	return func(s *Status) bool {
+		for _, c := range terms {
+			if !c(s) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// parseTerm parses one term of a condition
+func parseTerm(term string) (condition, error) {
+	if strings.HasPrefix(term, "addr=") {
+		parts := strings.SplitN(strings.TrimPrefix(term, "addr="), "-", 2)
+		low, err := strconv.ParseUint(parts[0], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address in %s", term)
+		}
+		high := low
+		if len(parts) == 2 {
+			if high, err = strconv.ParseUint(parts[1], 16, 32); err != nil {
+				return nil, fmt.Errorf("invalid address in %s", term)
+			}
+		}
+		return func(s *Status) bool {
+			return uint64(s.absoluteAddress) >= low && uint64(s.absoluteAddress) <= high
+		}, nil
+	}
+
+	if strings.HasPrefix(term, "op=") {
+		opCodes := make(map[uint16]bool)
+		for _, name := range strings.Split(strings.TrimPrefix(term, "op="), ",") {
+			opCode, ok := Opcode(strings.ToUpper(name))
+			if !ok {
+				return nil, fmt.Errorf("unknown mnemonic %s", strings.ToUpper(name))
+			}
+			opCodes[opCode] = true
+		}
+		return func(s *Status) bool {
+			return opCodes[s.opCode]
+		}, nil
+	}
+
+	for _, comparison := range comparisons {
+		i := strings.Index(term, comparison.operator)
+		if i < 0 {
+			continue
+		}
+		register, ok := registers[term[:i]]
+		if !ok {
+			return nil, fmt.Errorf("unknown register in %s", term)
+		}
+		n, err := strconv.ParseUint(term[i+len(comparison.operator):], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in %s", term)
+		}
+		compare := comparison.compare
+		return func(s *Status) bool {
+			return compare(register(s), uint16(n))
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid condition %s", term)
+}
+
+// show prints the i'th remembered instruction with its sequence number
+func (h *tHistory) show(i int) {
+	fmt.Printf("%10d %s\n", h.seq(i), createDisassemblyString(*h.entry(i)))
+}
+
+// Filter shows the most recent maxShown instructions (oldest first)
+// which match conditions (see parseConditions).
+// A negative maxShown shows none.
+func (h *tHistory) Filter(conditions string, maxShown int) error {
+	c, err := parseConditions(conditions)
+	if err != nil {
+		return err
+	}
+
+	var matches []int
+	for i := 0; i < h.numEntries; i++ {
+		if c(h.entry(i)) {
+			matches = append(matches, i)
+		}
+	}
+	fmt.Printf("%d of %d instructions match\n", len(matches), h.numEntries)
+	maxShown = intmaxmin.Constrain(maxShown, 0, len(matches))
+	matches = matches[len(matches)-maxShown:]
+	for _, i := range matches {
+		h.show(i)
+	}
+	return nil
+}
+
+// LastExecutions shows the last k executions of the instruction at address
+func (h *tHistory) LastExecutions(address uint32, k int) error {
+	return h.Filter(fmt.Sprintf("addr=%X", address), k)
+}
+
+// FindFirst shows the first instruction for which conditions
+// became true i.e. were true and were false (or there was no
+// history) for the instruction before
+func (h *tHistory) FindFirst(conditions string) error {
+	c, err := parseConditions(conditions)
+	if err != nil {
+		return err
+	}
+
+	wasTrue := false
+	for i := 0; i < h.numEntries; i++ {
+		isTrue := c(h.entry(i))
+		if isTrue && !wasTrue {
+			if i == 0 {
+				fmt.Printf("True for the oldest remembered instruction\n")
+			} else {
+				h.show(i - 1)
+			}
+			h.show(i)
+			return nil
+		}
+		wasTrue = isTrue
+	}
+	fmt.Printf("Never true in the %d remembered instructions\n", h.numEntries)
+	return nil
+}
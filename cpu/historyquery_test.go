@@ -0,0 +1,26 @@
+package cpu
+
+import "testing"
+
+// newTestHistory returns a history of instructions at the addresses
+func newTestHistory(addresses ...uint32) *tHistory {
+	h := newHistory(16)
+	for _, a := range addresses {
+		h.logInstruction(Status{absoluteAddress: a})
+	}
+	return h
+}
+
+func TestFilterCounts(t *testing.T) {
+	h := newTestHistory(0x400, 0x401, 0x400, 0x402, 0x400)
+	for _, maxShown := range []int{-1, 0, 2, 3, 100} {
+		if err := h.Filter("addr=400", maxShown); err != nil {
+			t.Errorf("maxShown %d: %v", maxShown, err)
+		}
+	}
+	for _, k := range []int{-5, 0, 1, 10} {
+		if err := h.LastExecutions(0x400, k); err != nil {
+			t.Errorf("k %d: %v", k, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cpu
+
+import "fmt"
+
+// mnemonics holds the assembler name of each opcode
+var mnemonics = map[uint16]string{
+	andOpcode:         "AND",
+	branchOpcode:      "BRA",
+	branchFalseOpcode: "JMPF",
+	csFetchOpcode:     "CS_FETCH",
+	diOpcode:          "DI",
+	doLitOpcode:       "DO_LIT",
+	dropOpcode:        "DROP",
+	dsFetchOpcode:     "DS_FETCH",
+	dupOpcode:         "DUP",
+	eiOpcode:          "EI",
+	equallOpcode:      "EQUAL",
+	esFetchOpcode:     "ES_FETCH",
+	fetchOpcode:       "FETCH",
+	fromROpcode:       "FROM_R",
+	haltOpcode:        "HALT",
+	jsrOpcode:         "JSR",
+	jsrintOpcode:      "JSRINT",
+	kSpStoreOpcode:    "K_SP_STORE",
+	lessOpcode:        "LESS",
+	longFetchOpcode:   "LONG_FETCH",
+	longStoreOpcode:   "LONG_STORE",
+	lvarOpcode:        "L_VAR",
+	mulOpcode:         "MUL",
+	negOpcode:         "NEG?",
+	nopOpcode:         "NOP",
+	orOpcode:          "OR",
+	overOpcode:        "OVER",
+	plusOpcode:        "PLUS",
+	plusPlusOpcode:    "PLUS_PLUS",
+	popFOpcode:        "POPF",
+	pushFOpcode:       "PUSHF",
+	rFetchOpcode:      "R_FETCH",
+	retOpcode:         "RET",
+	retiOpcode:        "RETI",
+	rpFetchOpcode:     "RP_FETCH",
+	rpStoreOpcode:     "RP_STORE",
+	sLessOpcode:       "S_LESS",
+	sllOpcode:         "SLL",
+	spFetchOpcode:     "SP_FETCH",
+	spStoreOpcode:     "SP_STORE",
+	sraOpcode:         "SRA",
+	srlOpcode:         "SRL",
+	storeOpcode:       "STORE",
+	store2Opcode:      "STORE2",
+	subOpcode:         "MINUS",
+	swapOpcode:        "SWAP",
+	sysCallOpcode:     "SYSCALL",
+	toDSOpcode:        "TO_DS",
+	toESOpcode:        "TO_ES",
+	toROpcode:         "TO_R",
+	umPlusOpcode:      "UM_PLUS",
+	xorOpcode:         "XOR",
+}
+
+// Mnemonic returns the assembler name of opCode
+func Mnemonic(opCode uint16) string {
+	if name, ok := mnemonics[opCode]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_%04X", opCode)
+}
+
+// Opcode returns the opcode with the assembler name mnemonic
+func Opcode(mnemonic string) (uint16, bool) {
+	for opCode, name := range mnemonics {
+		if name == mnemonic {
+			return opCode, true
+		}
+	}
+	return 0, false
+}
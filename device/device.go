@@ -0,0 +1,79 @@
+package device
+
+// Interrupt is a named interrupt output of a device.
+// Asserted is meant to be used as an interrupt controller callback.
+type Interrupt struct {
+	Name     string
+	Asserted func() bool
+}
+
+// Device is implemented by everything which plugs into the machine
+// e.g. ROM, RAM, serial ports and the interrupt controller.
+// Addresses passed to Read and Write are relative to the device.
+type Device interface {
+	Name() string
+	Read(address uint32) uint16
+	Write(address uint32, value uint16)
+	// Tick is called on every tick of the virtual clock
+	Tick()
+	// Reset is called when the computer is reset
+	Reset()
+	// Interrupts lists the device's interrupt outputs (may be empty)
+	Interrupts() []Interrupt
+}
+
+// Registry holds every device in the machine so they can be
+// ticked and reset without the main loop knowing about each one.
+type Registry struct {
+	devices []Device
+}
+
+// Register adds d to the registry.  Devices are ticked in the
+// order they were registered.  Registering a device twice is a no-op.
+func (r *Registry) Register(d Device) {
+	for _, existing := range r.devices {
+		if existing == d {
+			return
+		}
+	}
+	r.devices = append(r.devices, d)
+}
+
+// Devices returns the registered devices in registration order
+func (r *Registry) Devices() []Device {
+	return r.devices
+}
+
+// Find returns the device called name or nil
+func (r *Registry) Find(name string) Device {
+	for _, d := range r.devices {
+		if d.Name() == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Tick ticks every registered device
+func (r *Registry) Tick() {
+	for _, d := range r.devices {
+		d.Tick()
+	}
+}
+
+// Reset resets every registered device
+func (r *Registry) Reset() {
+	for _, d := range r.devices {
+		d.Reset()
+	}
+}
+
+// FindInterrupt returns d's interrupt output called name
+func FindInterrupt(d Device, name string) (func() bool, bool) {
+	for _, i := range d.Interrupts() {
+		if i.Name == name {
+			return i.Asserted, true
+		}
+	}
+	return nil, false
+}
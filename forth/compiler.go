@@ -0,0 +1,478 @@
+// Package forth is a cross compiler for a subset of Forth.
+// It produces a relocatable object which object.Link turns into a
+// V4 image.  The subset is colon definitions, IF ELSE THEN, BEGIN
+// UNTIL AGAIN WHILE REPEAT, DO LOOP (with I and J), VARIABLE,
+// CONSTANT, ALLOT, RECURSE, S" and ." plus the words in primitives
+// and prelude.  Words are not case sensitive.  Redefining a word or
+// primitive prints a warning; later uses get the new definition.
+// Strings must be ASCII.
+//
+// The program starts at _start which sets up the stacks,
+// calls main and halts.
+package forth
+
+import (
+	"albert_go_sim/object"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StackSize is the size in words of each of the stacks
+const StackSize = 256
+
+// StartSymbol is the entry point of every program
+const StartSymbol = "_start"
+
+// Kinds of dictionary entry
+const (
+	colonWord = iota
+	variableWord
+	constantWord
+)
+
+// word is a dictionary entry
+type word struct {
+	kind   int
+	offset uint16 // colon: code offset; variable: data offset
+	value  uint16 // constant
+	symbol int    // index into the object's symbols
+}
+
+// control is an entry on the control flow stack
+type control struct {
+	name   string // the word which pushed it
+	offset uint16 // the code offset to branch to or to patch
+	line   int
+}
+
+// Compiler holds the state of one compilation
+type Compiler struct {
+	obj         object.Object
+	dictionary  map[string]*word
+	controls    []control
+	numbers     []uint16 // numbers given outside definitions
+	current     string   // the name being defined; "" outside definitions
+	currentWord *word
+	start       uint16
+	tokens      *tokenizer
+	fileName    string
+}
+
+// Compile compiles source (read from fileName) and returns
+// an object ready for object.Link with StartSymbol as its entry
+func Compile(source string, fileName string) (*object.Object, error) {
+	c := Compiler{dictionary: make(map[string]*word)}
+	c.obj.Module = fileName
+	c.obj.Entry = StartSymbol
+
+	c.startup()
+	if err := c.compile(prelude, "prelude"); err != nil {
+		return nil, err
+	}
+	if err := c.compile(source, fileName); err != nil {
+		return nil, err
+	}
+
+	main, ok := c.dictionary["main"]
+	if !ok || main.kind != colonWord {
+		return nil, fmt.Errorf("%s: no main word", fileName)
+	}
+	c.patch(c.start, main.offset)
+
+	if err := c.obj.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return &c.obj, nil
+}
+
+// startup emits _start and allocates the stacks.
+// The call to main is patched once main is defined.
+func (c *Compiler) startup() {
+	returnStack := c.allot(StackSize)
+	// The first push of the program is to the word before the parameter stack
+	parameterStack := c.allot(StackSize+1) + 1
+	c.define(StartSymbol, object.Code, c.here())
+
+	c.literalData(parameterStack)
+	c.emit(spStoreOpcode)
+	c.literalData(returnStack)
+	c.emit(rpStoreOpcode)
+	c.start = c.branch(jsrOpcode, object.KindJSR, 0)
+	c.emit(haltOpcode)
+}
+
+// compile compiles one source file
+func (c *Compiler) compile(source string, fileName string) error {
+	c.tokens = newTokenizer(source)
+	c.fileName = fileName
+	for {
+		token, ok := c.tokens.next()
+		if !ok {
+			break
+		}
+		line := c.tokens.line
+		if err := c.compileToken(token); err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", fileName, line, token, err)
+		}
+	}
+	if c.current != "" {
+		return fmt.Errorf("%s: definition of %s is not finished", fileName, c.current)
+	}
+	if len(c.numbers) != 0 {
+		return fmt.Errorf("%s: %d numbers are left over outside a definition", fileName, len(c.numbers))
+	}
+	return nil
+}
+
+// compileToken compiles or interprets one token
+func (c *Compiler) compileToken(token string) error {
+	name := strings.ToLower(token)
+
+	if c.current == "" {
+		return c.interpret(name)
+	}
+
+	if n, ok := parseNumber(name); ok {
+		c.literal(n)
+		return nil
+	}
+	// A definition shadows a primitive of the same name
+	if w, ok := c.dictionary[name]; ok {
+		switch w.kind {
+		case colonWord:
+			c.branch(jsrOpcode, object.KindJSR, w.offset)
+		case variableWord:
+			c.literalData(w.offset)
+		case constantWord:
+			c.literal(w.value)
+		}
+		return nil
+	}
+	if code, ok := primitives[name]; ok {
+		c.emit(code...)
+		return nil
+	}
+	return c.compileControl(name)
+}
+
+// interpret handles a token outside a definition
+func (c *Compiler) interpret(name string) error {
+	if n, ok := parseNumber(name); ok {
+		c.numbers = append(c.numbers, n)
+		return nil
+	}
+
+	switch name {
+	case ":":
+		newName, err := c.nextName()
+		if err != nil {
+			return err
+		}
+		c.warnIfDefined(newName)
+		// The new word is not visible until ;
+		c.current = newName
+		c.currentWord = &word{kind: colonWord, offset: c.here()}
+
+	case "variable":
+		newName, err := c.nextName()
+		if err != nil {
+			return err
+		}
+		c.warnIfDefined(newName)
+		c.redefine(newName, &word{kind: variableWord, offset: c.allot(1)}, object.Data)
+
+	case "constant":
+		newName, err := c.nextName()
+		if err != nil {
+			return err
+		}
+		c.warnIfDefined(newName)
+		n, err := c.popNumber()
+		if err != nil {
+			return err
+		}
+		c.redefine(newName, &word{kind: constantWord, value: n}, object.Data)
+
+	case "allot":
+		n, err := c.popNumber()
+		if err != nil {
+			return err
+		}
+		c.allot(int(n))
+
+	default:
+		return fmt.Errorf("only numbers, :, VARIABLE, CONSTANT and ALLOT may be used outside a definition")
+	}
+	return nil
+}
+
+// compileControl compiles the words which are not simply inlined or called
+func (c *Compiler) compileControl(name string) error {
+	switch name {
+	case ";":
+		if len(c.controls) != 0 {
+			top := c.controls[len(c.controls)-1]
+			return fmt.Errorf("%s on line %d is not finished", top.name, top.line)
+		}
+		c.emit(retOpcode)
+		c.redefine(c.current, c.currentWord, object.Code)
+		c.current = ""
+
+	case "recurse":
+		c.branch(jsrOpcode, object.KindJSR, c.currentWord.offset)
+
+	case "if":
+		c.push("if", c.branch(jmpfOpcode, object.KindJMPF, 0))
+
+	case "else":
+		ifControl, err := c.pop("if")
+		if err != nil {
+			return err
+		}
+		c.push("else", c.branch(branchOpcode, object.KindBRA, 0))
+		c.patch(ifControl.offset, c.here())
+
+	case "then":
+		control, err := c.pop("if", "else")
+		if err != nil {
+			return err
+		}
+		c.patch(control.offset, c.here())
+
+	case "begin":
+		c.push("begin", c.here())
+
+	case "until", "again":
+		control, err := c.pop("begin")
+		if err != nil {
+			return err
+		}
+		if name == "until" {
+			c.branch(jmpfOpcode, object.KindJMPF, control.offset)
+		} else {
+			c.branch(branchOpcode, object.KindBRA, control.offset)
+		}
+
+	case "while":
+		if len(c.controls) == 0 || c.controls[len(c.controls)-1].name != "begin" {
+			return fmt.Errorf("WHILE without BEGIN")
+		}
+		c.push("while", c.branch(jmpfOpcode, object.KindJMPF, 0))
+
+	case "repeat":
+		whileControl, err := c.pop("while")
+		if err != nil {
+			return err
+		}
+		beginControl, err := c.pop("begin")
+		if err != nil {
+			return err
+		}
+		c.branch(branchOpcode, object.KindBRA, beginControl.offset)
+		c.patch(whileControl.offset, c.here())
+
+	case "do":
+		// ( limit start -- ) R: -- limit index
+		c.emit(swapOpcode, toROpcode, toROpcode)
+		c.push("do", c.here())
+
+	case "loop":
+		control, err := c.pop("do")
+		if err != nil {
+			return err
+		}
+		// index+1 limit, put both back, loop unless they are equal
+		c.emit(fromROpcode, doLitOpcode, 1, plusOpcode, fromROpcode,
+			overOpcode, overOpcode, toROpcode, toROpcode, equalOpcode)
+		c.branch(jmpfOpcode, object.KindJMPF, control.offset)
+		c.emit(fromROpcode, dropOpcode, fromROpcode, dropOpcode)
+
+	case `s"`, `."`:
+		s, err := c.tokens.until('"')
+		if err != nil {
+			return err
+		}
+		for _, r := range s {
+			if r > 0x7F {
+				return fmt.Errorf("string contains non-ASCII character %q", r)
+			}
+		}
+		address := c.allot(len(s))
+		for i, r := range s {
+			c.obj.Data[int(address)+i] = uint16(r)
+		}
+		c.literalData(address)
+		c.literal(uint16(len(s)))
+		if name == `."` {
+			c.branch(jsrOpcode, object.KindJSR, c.dictionary["type"].offset)
+		}
+
+	case ":", "variable", "constant", "allot":
+		return fmt.Errorf("may not be used inside a definition")
+
+	default:
+		return fmt.Errorf("unknown word")
+	}
+	return nil
+}
+
+// nextName returns the name following a defining word
+func (c *Compiler) nextName() (string, error) {
+	token, ok := c.tokens.next()
+	if !ok {
+		return "", fmt.Errorf("name expected")
+	}
+	return strings.ToLower(token), nil
+}
+
+// popNumber returns the last number given outside a definition
+func (c *Compiler) popNumber() (uint16, error) {
+	if len(c.numbers) == 0 {
+		return 0, fmt.Errorf("number expected before")
+	}
+	n := c.numbers[len(c.numbers)-1]
+	c.numbers = c.numbers[:len(c.numbers)-1]
+	return n, nil
+}
+
+// warnIfDefined warns (as other Forths do) that name is being redefined
+func (c *Compiler) warnIfDefined(name string) {
+	_, isPrimitive := primitives[name]
+	_, isDefined := c.dictionary[name]
+	if isPrimitive || isDefined {
+		fmt.Printf("WARNING %s:%d: %s redefined\n", c.fileName, c.tokens.line, name)
+	}
+}
+
+// redefine adds w to the dictionary as name with a symbol in section
+// (constants have no symbol).  A previous definition keeps its
+// code but its symbol is renamed name~1, name~2 ...
+func (c *Compiler) redefine(name string, w *word, section object.Section) {
+	if old, ok := c.dictionary[name]; ok && old.kind != constantWord {
+		for i := 1; ; i++ {
+			oldName := fmt.Sprintf("%s~%d", name, i)
+			if c.findSymbol(oldName) < 0 {
+				c.obj.Symbols[old.symbol].Name = oldName
+				break
+			}
+		}
+	}
+	if w.kind != constantWord {
+		w.symbol = c.define(name, section, w.offset)
+	}
+	c.dictionary[name] = w
+}
+
+// findSymbol returns the index of the symbol called name or -1
+func (c *Compiler) findSymbol(name string) int {
+	for i, s := range c.obj.Symbols {
+		if s.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// define adds a symbol and returns its index
+func (c *Compiler) define(name string, section object.Section, offset uint16) int {
+	c.obj.Symbols = append(c.obj.Symbols, object.Symbol{Name: name, Section: section, Offset: offset})
+	return len(c.obj.Symbols) - 1
+}
+
+// here returns the offset of the next code word
+func (c *Compiler) here() uint16 {
+	return uint16(len(c.obj.Code))
+}
+
+// emit appends words to the code
+func (c *Compiler) emit(words ...uint16) {
+	c.obj.Code = append(c.obj.Code, words...)
+}
+
+// allot adds n zero words to the data and returns the offset of the first
+func (c *Compiler) allot(n int) uint16 {
+	offset := uint16(len(c.obj.Data))
+	c.obj.Data = append(c.obj.Data, make([]uint16, n)...)
+	return offset
+}
+
+// literal emits DO_LIT n
+func (c *Compiler) literal(n uint16) {
+	c.emit(doLitOpcode, n)
+}
+
+// literalData emits DO_LIT with the address of offset in the data
+func (c *Compiler) literalData(offset uint16) {
+	c.emit(doLitOpcode, offset)
+	c.obj.Relocations = append(c.obj.Relocations, object.Relocation{
+		Section: object.Code, Offset: c.here() - 1, Kind: object.KindDoLit, Target: object.Data,
+	})
+}
+
+// branch emits a JSR, BRA or JMPF to offset in the code and
+// returns the offset of its operand for patching
+func (c *Compiler) branch(opcode uint16, kind string, offset uint16) uint16 {
+	c.emit(opcode, offset)
+	c.obj.Relocations = append(c.obj.Relocations, object.Relocation{
+		Section: object.Code, Offset: c.here() - 1, Kind: kind, Target: object.Code,
+	})
+	return c.here() - 1
+}
+
+// patch sets the operand at operandOffset to branch to offset
+func (c *Compiler) patch(operandOffset uint16, offset uint16) {
+	c.obj.Code[operandOffset] = offset
+}
+
+// push adds an entry to the control flow stack
+func (c *Compiler) push(name string, offset uint16) {
+	c.controls = append(c.controls, control{name: name, offset: offset, line: c.tokens.line})
+}
+
+// pop removes the top of the control flow stack which must
+// have been pushed by one of names
+func (c *Compiler) pop(names ...string) (control, error) {
+	if len(c.controls) == 0 {
+		return control{}, fmt.Errorf("no matching %s", strings.Join(upperNames(names), " or "))
+	}
+	top := c.controls[len(c.controls)-1]
+	for _, name := range names {
+		if top.name == name {
+			c.controls = c.controls[:len(c.controls)-1]
+			return top, nil
+		}
+	}
+	return control{}, fmt.Errorf("does not match %s on line %d", strings.ToUpper(top.name), top.line)
+}
+
+// upperNames returns names in upper case as Forth words are usually written
+func upperNames(names []string) []string {
+	var upper []string
+	for _, name := range names {
+		upper = append(upper, strings.ToUpper(name))
+	}
+	return upper
+}
+
+// parseNumber accepts decimal, $hex and 0x hex numbers with an optional -
+func parseNumber(s string) (uint16, bool) {
+	isNegative := strings.HasPrefix(s, "-") && len(s) > 1
+	if isNegative {
+		s = s[1:]
+	}
+	base := 10
+	if strings.HasPrefix(s, "$") {
+		s, base = s[1:], 16
+	} else if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	}
+	n, err := strconv.ParseUint(s, base, 16)
+	if err != nil {
+		return 0, false
+	}
+	if isNegative {
+		return uint16(-int(n)), true
+	}
+	return uint16(n), true
+}
@@ -0,0 +1,85 @@
+package forth
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenizer splits source into white space separated tokens,
+// skipping \ and ( ) comments
+type tokenizer struct {
+	source []rune
+	pos    int
+	line   int
+}
+
+func newTokenizer(source string) *tokenizer {
+	return &tokenizer{source: []rune(source), line: 1}
+}
+
+// skipSpace moves past white space, counting lines
+func (t *tokenizer) skipSpace() {
+	for t.pos < len(t.source) && unicode.IsSpace(t.source[t.pos]) {
+		if t.source[t.pos] == '\n' {
+			t.line++
+		}
+		t.pos++
+	}
+}
+
+// word returns the next white space separated word
+func (t *tokenizer) word() (string, bool) {
+	t.skipSpace()
+	if t.pos >= len(t.source) {
+		return "", false
+	}
+	start := t.pos
+	for t.pos < len(t.source) && !unicode.IsSpace(t.source[t.pos]) {
+		t.pos++
+	}
+	return string(t.source[start:t.pos]), true
+}
+
+// next returns the next token which is not part of a comment
+func (t *tokenizer) next() (string, bool) {
+	for {
+		token, ok := t.word()
+		if !ok {
+			return "", false
+		}
+		switch token {
+		case `\`:
+			for t.pos < len(t.source) && t.source[t.pos] != '\n' {
+				t.pos++
+			}
+		case "(":
+			if _, err := t.until(')'); err != nil {
+				return "", false
+			}
+		default:
+			return token, true
+		}
+	}
+}
+
+// until returns the text up to (and skips) the delimiter.
+// One space after the preceding word is not part of the text.
+func (t *tokenizer) until(delimiter rune) (string, error) {
+	if t.pos < len(t.source) && t.source[t.pos] == ' ' {
+		t.pos++
+	}
+	start := t.pos
+	for t.pos < len(t.source) && t.source[t.pos] != delimiter {
+		if t.source[t.pos] == '\n' {
+			t.line++
+		}
+		t.pos++
+	}
+	if t.pos >= len(t.source) {
+		return "", fmt.Errorf("missing %s", strings.TrimSpace(string(delimiter)))
+	}
+	text := string(t.source[start:t.pos])
+	t.pos++
+	return text, nil
+}
@@ -0,0 +1,91 @@
+package forth
+
+// Opcodes used by the compiler.  These must match the cpu package.
+const (
+	nopOpcode     = 1
+	doLitOpcode   = 2
+	haltOpcode    = 3
+	branchOpcode  = 4
+	lessOpcode    = 5
+	dropOpcode    = 7
+	storeOpcode   = 8
+	fetchOpcode   = 9
+	jsrOpcode     = 10
+	retOpcode     = 11
+	jmpfOpcode    = 12
+	toROpcode     = 13
+	fromROpcode   = 14
+	sllOpcode     = 15
+	rpFetchOpcode = 16
+	rpStoreOpcode = 17
+	rFetchOpcode  = 18
+	dupOpcode     = 19
+	swapOpcode    = 21
+	overOpcode    = 22
+	spStoreOpcode = 23
+	plusOpcode    = 24
+	subOpcode     = 25
+	negOpcode     = 26
+	andOpcode     = 27
+	orOpcode      = 28
+	xorOpcode     = 29
+	mulOpcode     = 30
+	equalOpcode   = 31
+	eiOpcode      = 35
+	sraOpcode     = 36
+	diOpcode      = 37
+)
+
+// primitives are compiled inline.  Names are lower case.
+var primitives = map[string][]uint16{
+	"+":      {plusOpcode},
+	"-":      {subOpcode},
+	"*":      {mulOpcode},
+	"and":    {andOpcode},
+	"or":     {orOpcode},
+	"xor":    {xorOpcode},
+	"=":      {equalOpcode},
+	"<":      {lessOpcode},
+	"0<":     {negOpcode},
+	"dup":    {dupOpcode},
+	"drop":   {dropOpcode},
+	"swap":   {swapOpcode},
+	"over":   {overOpcode},
+	">r":     {toROpcode},
+	"r>":     {fromROpcode},
+	"r@":     {rFetchOpcode},
+	"@":      {fetchOpcode},
+	"!":      {storeOpcode},
+	"2*":     {sllOpcode},
+	"2/":     {sraOpcode},
+	"ei":     {eiOpcode},
+	"di":     {diOpcode},
+	"halt":   {haltOpcode},
+	"nop":    {nopOpcode},
+	"exit":   {retOpcode},
+	"0=":     {doLitOpcode, 0, equalOpcode},
+	"not":    {doLitOpcode, 0, equalOpcode},
+	"<>":     {equalOpcode, doLitOpcode, 0, equalOpcode},
+	">":      {swapOpcode, lessOpcode},
+	"negate": {doLitOpcode, 0, swapOpcode, subOpcode},
+	"invert": {doLitOpcode, 0xFFFF, xorOpcode},
+	"1+":     {doLitOpcode, 1, plusOpcode},
+	"1-":     {doLitOpcode, 1, subOpcode},
+	"rot":    {toROpcode, swapOpcode, fromROpcode, swapOpcode},
+	"nip":    {swapOpcode, dropOpcode},
+	"2dup":   {overOpcode, overOpcode},
+	"+!":     {dupOpcode, toROpcode, fetchOpcode, plusOpcode, fromROpcode, storeOpcode},
+	"i":      {rFetchOpcode},
+	// The outer loop index is under the inner limit on the return stack
+	"j": {rpFetchOpcode, doLitOpcode, 2, subOpcode, fetchOpcode},
+}
+
+// prelude is compiled before every program.
+// It assumes the console serial port is at F000 and DS is 0.
+const prelude = `
+: emit ( c -- )  begin $F001 @ 1 and until $F000 ! ;
+: key ( -- c )  begin $F001 @ 2 and until $F000 @ ;
+: cr ( -- )  13 emit 10 emit ;
+: type ( addr len -- )
+  begin dup while swap dup @ emit 1+ swap 1- repeat drop drop ;
+`
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"albert_go_sim/blockdevice"
 	"albert_go_sim/cli"
 	"albert_go_sim/clock"
+	"albert_go_sim/config"
 	"albert_go_sim/counter"
 	"albert_go_sim/cpu"
 	"albert_go_sim/interruptcontroller"
+	"albert_go_sim/loader"
 	"albert_go_sim/memory"
 	"albert_go_sim/ram"
 	"albert_go_sim/rom"
+	"albert_go_sim/rtc"
 	"albert_go_sim/serialport"
+	"albert_go_sim/timer"
+	"albert_go_sim/trace"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -31,6 +38,20 @@ var clock1 clock.Clock
 var rom1 rom.Rom
 var ram1 ram.RAM
 
+// consoleTelnet turns on telnet negotiation on the console
+var consoleTelnet bool
+
+// consoleObserverPort (if not 0) is the TCP port for read-only
+// observers of the console
+var consoleObserverPort int
+
+// load403Address is where 403 files are loaded (see -loadaddress)
+var load403Address uint32 = loader.Default403LoadAddress
+
+// romFile and romFormat select the ROM image (see initROM)
+var romFile string
+var romFormat string
+
 var isKeyboardInterrupt bool = false
 var numClockTicks uint64 = 0
 var numSecondsTick uint32 = 0
@@ -40,6 +61,9 @@ var consoleSerialPort serialport.SerialPort
 var diskControllerPort serialport.SerialPort
 var terminalControllerPort serialport.SerialPort
 var interruptController1 interruptcontroller.InterruptController
+var blockDevice1 blockdevice.BlockDevice
+var timer1 timer.Timer
+var rtc1 rtc.RTC
 
 // Init initializes the global runtime for the simulator
 func Init() {
@@ -50,7 +74,11 @@ func Init() {
 	// Then we connect to the interrupt controller (via callbacks) if necessary
 	// We also have to provide memory callbacks to the cpu
 	counter1.Init()
+	timer1.Init()
+	rtc1.Init()
 
+	consoleSerialPort.UseTelnet = consoleTelnet
+	consoleSerialPort.ObserverPort = consoleObserverPort
 	consoleSerialPort.Init("Console Serial Port", 5000)
 	for {
 		enableControllers = cli.RawInput("Do you want to init disk and term controllers (y/n) >")
@@ -64,39 +92,105 @@ func Init() {
 		terminalControllerPort.Init("Terminal Controller", 6000)
 	}
 
+	blockDeviceImage := cli.RawInput("Enter block device image file (blank for none) >")
+	if blockDeviceImage != "" {
+		if err := blockDevice1.Init(blockDeviceImage, false); err != nil {
+			fmt.Printf("Could not open block device image: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	interruptController1.Init()
 
 	mycpu.Init()
 	// ram does not need to be initialized
-	rom1.Init()
+	initROM()
+
+	// Register the devices which are not memory mapped and decide
+	// the tick order; sources must tick before the interrupt controller.
+	mem.Registry.Register(&counter1)
+	if enableControllers == "y" {
+		mem.Registry.Register(&terminalControllerPort)
+		mem.Registry.Register(&diskControllerPort)
+	}
+	mem.Registry.Register(&consoleSerialPort)
 
 	// Add all of the devices to the memory map
 	// This corresponds to the chip select glue logic in the hardware
-	mem.AddDevice(memory.RomCS, rom1.Read, rom1.Write)
-	mem.AddDevice(memory.RAMCS, ram1.Read, ram1.Write)
-	mem.AddDevice(memory.F000, consoleSerialPort.Read, consoleSerialPort.Write)
-	mem.AddDevice(memory.F010, interruptController1.Read, interruptController1.Write)
+	mem.AddDevice(memory.RomCS, &rom1)
+	mem.AddDevice(memory.RAMCS, &ram1)
+	mem.AddDevice(memory.F000, &consoleSerialPort)
+	mem.AddDevice(memory.F0B0, &timer1)
+	mem.AddDevice(memory.F0C0, &rtc1)
 	if enableControllers == "y" {
-		mem.AddDevice(memory.F030, terminalControllerPort.Read, terminalControllerPort.Write)
-		mem.AddDevice(memory.F090, diskControllerPort.Read, diskControllerPort.Write)
+		mem.AddDevice(memory.F030, &terminalControllerPort)
+		mem.AddDevice(memory.F090, &diskControllerPort)
+	}
+	if blockDeviceImage != "" {
+		mem.AddDevice(memory.F0A0, &blockDevice1)
 	}
+	mem.AddDevice(memory.F010, &interruptController1)
 
 	// Connect sources to the interrupt controller.
 	// The assignments are boolean callbacks
 	interruptController1.Callbacks[1] = counter1.CounterIsZero
 
+	interruptController1.Callbacks[2] = consoleSerialPort.RXIsNotEmpty
+	interruptController1.Callbacks[3] = consoleSerialPort.TXIsEmpty
+	interruptController1.Callbacks[6] = consoleSerialPort.TXIsBelowHalf
+	interruptController1.Callbacks[7] = consoleSerialPort.RXHasOverrun
+
 	interruptController1.Callbacks[5] = terminalControllerPort.RXIsQuarterFull
 
 	interruptController1.Callbacks[4] = diskControllerPort.RXIsHalfFull
 
+	interruptController1.Callbacks[8] = blockDevice1.IsDone
+
+	interruptController1.Callbacks[9] = timer1.HasMatched
+
+	interruptController1.Callbacks[10] = rtc1.AlarmFired
+
 	clock1.Frequency = 10000000
 	clock1.DoPrint = true
 
+	// The block device moves sectors without the cpu (DMA)
+	blockDevice1.ReadMemory = mem.Read
+	blockDevice1.WriteMemory = mem.Write
+
+	connectCPU()
+	watchKeyboardInterrupt()
+}
+
+// initROM loads romFile (in romFormat) or, if romFile
+// is empty, the built in loader into the ROM
+func initROM() {
+	if romFile == "" {
+		rom1.Init()
+		return
+	}
+	if err := rom1.InitFromFile(romFile, romFormat); err != nil {
+		fmt.Printf("Could not load ROM image: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// connectCPU provides the memory and interrupt controller
+// callbacks to the cpu (and the cpu callbacks to the controller)
+func connectCPU() {
 	mycpu.ReadCodeMemory = mem.ReadCodeMemory
 	mycpu.ReadDataMemory = mem.Read
 	mycpu.WriteDataMemory = mem.Write
+	mycpu.PeekMemory = mem.Peek
+	mem.InstructionAddress = mycpu.InstructionAddress
 	mycpu.InterruptCallback = interruptController1.GetOutput
+	mycpu.InterruptAcknowledge = interruptController1.Acknowledge
+	mycpu.InterruptTaken = interruptController1.InterruptTaken
+	mycpu.InterruptReturned = interruptController1.InterruptReturned
+	interruptController1.InterruptsEnabled = mycpu.InterruptsEnabled
+}
 
+// watchKeyboardInterrupt sets isKeyboardInterrupt when the user presses CTL-C
+func watchKeyboardInterrupt() {
 	// There's a little bit of magic here.  We've created a goroutine
 	// so that we can sets a global var
 	// to indicate the user has pressed CTL-C
@@ -121,10 +215,7 @@ func resetComputer() {
 	mycpu.ES = 0
 	mycpu.IntCtlLow = 0
 	cpu.History.Clear()
-	ram1.Clear()
-	consoleSerialPort.Reset()
-	diskControllerPort.Reset()
-	terminalControllerPort.Reset()
+	mem.Registry.Reset()
 	fmt.Printf("The computer has been reset.\n")
 }
 
@@ -146,11 +237,7 @@ func runSimulator(mode int) {
 
 		clock1.Tick()
 
-		consoleSerialPort.Tick()
-		diskControllerPort.Tick()
-		terminalControllerPort.Tick()
-		counter1.Tick()
-		interruptController1.Tick()
+		mem.Registry.Tick()
 
 		// Check to see if caller only wants to single step
 		// because, if so, we may have to call Tick() multiple
@@ -204,149 +291,287 @@ func showStacks() {
 
 }
 
-// load403File - uses Original Pat loader format from 2006!
-// It is interactive and prompts for a file name.
-// TODO create a return value to show success or failure
-func load403File() {
+// simulatedMachine connects loaders to the simulated memory and cpu
+type simulatedMachine struct{}
+
+func (simulatedMachine) CheckWritable(start uint32, count uint32) error {
+	return mem.CheckWritableRange(start, count)
+}
 
-	// read4 returns uint16 by reading 4 HEX digits from f
-	read4 := func(f *os.File) uint16 {
-		b := make([]byte, 4)
-		f.Read(b)
-		s := string(b)
-		n, _ := strconv.ParseUint(s, 16, 32)
-		w := uint16(n)
-		return (w)
+func (simulatedMachine) Write(address uint32, value uint16) {
+	mem.Write(address, value)
+}
 
+func (simulatedMachine) SetPC(pc uint16) {
+	mycpu.SetPC(pc)
+}
+
+// loadFile loads an image in format (or the detected format
+// if format is empty) and sets the PC to its start address
+func loadFile(fileName string, format string, options loader.Options) error {
+	image, err := loader.ReadFile(fileName, format, options)
+	if err != nil {
+		return err
 	}
+	image.Inspect(os.Stdout)
+	return image.LoadInto(simulatedMachine{})
+}
 
-	filename := cli.RawInput("Enter 403 file name >")
-	fileInfo, err := os.Stat(filename)
+// inspectFile prints a description of an image
+func inspectFile(fileName string, options loader.Options) error {
+	image, err := loader.ReadFile(fileName, "", options)
 	if err != nil {
-		fmt.Printf("Could not stat file [%s].  Returning\n", filename)
-		return
+		return err
 	}
-	actualFileSize := fileInfo.Size()
-	fmt.Printf("File Size is %d\n", actualFileSize)
-	if actualFileSize < 12 {
-		fmt.Printf("File is too small to be a valid 403 file; returning...\n")
+	image.Inspect(os.Stdout)
+	return nil
+}
+
+// loadHexFile interactively loads an Intel HEX or S-record file
+func loadHexFile() {
+	fileName := cli.RawInput("Enter Intel HEX or S-record file name >")
+	addressing, err := loader.ParseAddressing(cli.RawInput("Enter addressing (word or byte, blank = word) >"))
+	if err != nil {
+		fmt.Printf("%v.  Nothing loaded.\n", err)
 		return
 	}
+	if err := loadFile(fileName, "", loader.Options{Addressing: addressing}); err != nil {
+		fmt.Printf("Could not load file: %v\n", err)
+	}
+}
 
-	f, err := os.Open(filename)
+// exportMemory interactively writes a range of memory to an
+// Intel HEX or S-record file.
+// The range must be RAM, so the file can be loaded again; ROM,
+// device registers (F000-F0DF in every 64K bank) and unmapped
+// memory are refused.
+func exportMemory() {
+	format := cli.RawInput("Enter format (ihex or srec) >")
+	if format != loader.FormatIntelHex && format != loader.FormatSRecord {
+		fmt.Printf("Unknown format.  Nothing exported.\n")
+		return
+	}
+	addressing, err := loader.ParseAddressing(cli.RawInput("Enter addressing (word or byte, blank = word) >"))
+	if err != nil {
+		fmt.Printf("%v.  Nothing exported.\n", err)
+		return
+	}
+	start, err := strconv.ParseUint(cli.RawInput("Enter starting address (in hex) >"), 16, 32)
+	if err != nil {
+		fmt.Printf("Invalid address.  Nothing exported.\n")
+		return
+	}
+	length, err := strconv.ParseUint(cli.RawInput("Enter number of words (in hex) >"), 16, 32)
 	if err != nil {
-		fmt.Printf("Could not open %s\n", filename)
+		fmt.Printf("Invalid length.  Nothing exported.\n")
+		return
+	}
+	if err := mem.CheckWritableRange(uint32(start), uint32(length)); err != nil {
+		fmt.Printf("%v.  Nothing exported.\n", err)
 		return
 	}
+	fileName := cli.RawInput("Enter file name >")
 
-	objectLength := read4(f)
-	requiredFileSize := 4 + 4 + 4*objectLength
-	if actualFileSize != int64(requiredFileSize) {
-		fmt.Printf("file size mismatch; returning...\n")
+	f, err := os.Create(fileName)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if format == loader.FormatIntelHex {
+		err = loader.ExportIntelHex(f, mem.Peek, uint32(start), uint32(length), addressing)
+	} else {
+		err = loader.ExportSRecord(f, mem.Peek, uint32(start), uint32(length), addressing)
 	}
-	startAddress := read4(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("Could not export memory: %v\n", err)
+	}
+}
 
-	fmt.Printf("Setting PC to [%04X]\n", startAddress)
-	mycpu.SetPC(startAddress)
+// traceFile is the file being streamed to by -trace or the t menu entry
+var traceFile *os.File
 
-	memoryAddress := uint32(0x0403)
-	for {
-		if objectLength == 0 {
-			break
-		}
-		dataWord := read4(f)
-		mem.Write(memoryAddress, dataWord)
-		memoryAddress++
-		objectLength--
+// startTrace streams every instruction executed to fileName in format
+func startTrace(fileName string, format string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
 	}
-
+	if err := cpu.History.StartTrace(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	traceFile = f
+	fmt.Printf("Tracing to %s\n", fileName)
+	return nil
 }
 
-// loadV4File -
-// It is interactive and prompts for a file name.
-// TODO create a return value to show success or failure
-func loadV4File() {
-
-	// read4 returns uint16 by reading 4 HEX digits from f
-	read4 := func(f *os.File) uint16 {
-		b := make([]byte, 2)
-		f.Read(b)
-		w := uint16(b[0])*256 + uint16(b[1])
-		return (w)
+// stopTrace finishes the trace started by startTrace
+func stopTrace() {
+	if traceFile == nil {
+		return
+	}
+	err := cpu.History.StopTrace()
+	if closeErr := traceFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("WARNING could not finish trace: %v\n", err)
+	}
+	fmt.Printf("Trace %s finished\n", traceFile.Name())
+	traceFile = nil
+}
 
+// toggleTrace interactively starts or stops streaming a trace
+func toggleTrace() {
+	if traceFile != nil {
+		stopTrace()
+		return
+	}
+	fileName := cli.RawInput("Enter trace file name >")
+	format := cli.RawInput("Enter format (jsonl or binary, blank = jsonl) >")
+	if format == "" {
+		format = trace.JSONLFormat
 	}
+	if err := startTrace(fileName, format); err != nil {
+		fmt.Printf("Could not start trace: %v\n", err)
+	}
+}
 
-	filename := cli.RawInput("Enter V4 file name >")
-	fileInfo, err := os.Stat(filename)
+// exportHistory interactively writes the history to a trace file
+func exportHistory() {
+	fileName := cli.RawInput("Enter trace file name >")
+	format := cli.RawInput("Enter format (jsonl or binary, blank = jsonl) >")
+	if format == "" {
+		format = trace.JSONLFormat
+	}
+	f, err := os.Create(fileName)
 	if err != nil {
-		fmt.Printf("Could not stat file [%s].  Returning\n", filename)
+		fmt.Printf("%v\n", err)
 		return
 	}
-	actualFileSize := fileInfo.Size()
-	fmt.Printf("File Size is %08X\n", actualFileSize)
-	if actualFileSize < 14 {
-		fmt.Printf("File is too small to be a valid V4 file; returning...\n")
-		return
+	err = cpu.History.Export(f, format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("Could not export history: %v\n", err)
 	}
+}
 
-	f, err := os.Open(filename)
+// queryHistory interactively searches the history.
+// kind is F (filter), K (last executions of an address)
+// or W (when did a condition become true).
+func queryHistory(kind string) {
+	var err error
+	switch kind {
+	case "F":
+		conditions := cli.RawInput("Enter conditions (e.g. addr=0400-04FF op=JSR ptos=0005 cs=0000) >")
+		maxShown, convErr := strconv.Atoi(cli.RawInput("Enter maximum number to show >"))
+		if convErr != nil || maxShown < 0 {
+			fmt.Printf("Invalid number\n")
+			return
+		}
+		err = cpu.History.Filter(conditions, maxShown)
+	case "K":
+		address, parseErr := strconv.ParseUint(cli.RawInput("Enter address (in hex) >"), 16, 32)
+		if parseErr != nil {
+			fmt.Printf("Invalid address\n")
+			return
+		}
+		k, convErr := strconv.Atoi(cli.RawInput("Enter number of executions to show >"))
+		if convErr != nil || k < 0 {
+			fmt.Printf("Invalid number\n")
+			return
+		}
+		err = cpu.History.LastExecutions(uint32(address), k)
+	case "W":
+		conditions := cli.RawInput("Enter conditions (e.g. rtos=0000 psp>1000) >")
+		err = cpu.History.FindFirst(conditions)
+	}
 	if err != nil {
-		fmt.Printf("Could not open V4 file %s\n", filename)
-		return
+		fmt.Printf("%v\n", err)
 	}
+}
 
-	magic1 := read4(f)
-	magic2 := read4(f)
-	if (magic1 != 0) || (magic2 != 4) {
-		fmt.Printf("Incorrect magic %04X %04X expected 0000:0004\n", magic1, magic2)
+// accessTraceFile is the file the memory access trace is written to
+// (nil when it goes to the terminal)
+var accessTraceFile *os.File
+
+// toggleAccessTrace interactively starts or stops the memory access trace
+func toggleAccessTrace() {
+	if mem.IsAccessTracing() {
+		mem.StopAccessTrace()
+		if accessTraceFile != nil {
+			accessTraceFile.Close()
+			accessTraceFile = nil
+		}
+		fmt.Printf("Memory access trace stopped\n")
 		return
 	}
 
-	codeSize := read4(f)
-	codeLoadAddress := read4(f)
-	codeStartAddress := read4(f)
-	dataSize := read4(f)
-	dataLoadAddress := read4(f)
-
-	fmt.Printf("Code Size [%04X]\n", codeSize)
-	fmt.Printf("Code Load Address [%04X]\n", codeLoadAddress)
-	fmt.Printf("Code Start Address [%04X]\n", codeStartAddress)
+	devices := cli.RawInput("Enter devices (e.g. F000 Console RAM, blank = all) >")
+	addressRange := cli.RawInput("Enter address range (e.g. F000-F0DF, blank = all) >")
+	filter, err := mem.ParseAccessFilter(devices, addressRange)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	fileName := cli.RawInput("Enter file name (blank = terminal) >")
+	if fileName == "" {
+		mem.StartAccessTrace(os.Stdout, filter)
+	} else {
+		f, err := os.Create(fileName)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		accessTraceFile = f
+		mem.StartAccessTrace(f, filter)
+	}
+	fmt.Printf("Memory access trace started\n")
+}
 
-	fmt.Printf("Data Size [%04X]\n", dataSize)
-	fmt.Printf("Data Load Address [%04X]\n", dataLoadAddress)
-	requiredFileSize := 7*2 + (2 * int(codeSize)) + (2 * int(dataSize))
-	fmt.Printf("Required File Size is [%08X]\n", requiredFileSize)
+// injectInterrupt interactively asserts an interrupt controller
+// input now or at a later (simulated) tick
+func injectInterrupt() {
+	interruptController1.ShowInjections()
 
-	if actualFileSize != int64(requiredFileSize) {
-		fmt.Printf("file size mismatch; returning...\n")
+	s := cli.RawInput("Enter interrupt number (0-15, blank to cancel all injections) >")
+	if s == "" {
+		interruptController1.ClearInjections()
+		fmt.Printf("All injections cancelled\n")
+		return
+	}
+	interruptNum, err := strconv.Atoi(s)
+	if err != nil {
+		fmt.Printf("Invalid interrupt number.  Nothing injected.\n")
+		return
 	}
 
-	fmt.Printf("Actual File Size and Calculated File Size match. Continuing...\n")
-
-	memoryAddress := uint32(codeLoadAddress)
-	for {
-		if codeSize == 0 {
-			break
-		}
-		dataWord := read4(f)
-		mem.Write(memoryAddress, dataWord)
-		memoryAddress++
-		codeSize--
+	s = cli.RawInput("Enter number of ticks (0 = until cleared) >")
+	numTicks, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid number of ticks.  Nothing injected.\n")
+		return
 	}
 
-	memoryAddress = uint32(dataLoadAddress)
-	for {
-		if dataSize == 0 {
-			break
+	s = cli.RawInput(fmt.Sprintf("Enter tick to inject at (now is %d, blank = now) >", interruptController1.CurrentTick()))
+	if s == "" {
+		err = interruptController1.Inject(interruptNum, numTicks)
+	} else {
+		atTick, parseErr := strconv.ParseUint(s, 10, 64)
+		if parseErr != nil {
+			fmt.Printf("Invalid tick.  Nothing injected.\n")
+			return
 		}
-		dataWord := read4(f)
-		mem.Write(memoryAddress, dataWord)
-		memoryAddress++
-		dataSize--
+		err = interruptController1.ScheduleInjection(atTick, interruptNum, numTicks)
+	}
+	if err != nil {
+		fmt.Printf("%v.  Nothing injected.\n", err)
 	}
-
-	mycpu.PC = codeStartAddress
-
 }
 
 func setPC() {
@@ -363,20 +588,102 @@ func helpMessage() {
 	fmt.Printf("   S - Show stacks\n")
 	fmt.Printf("   b - Set break point\n")
 	fmt.Printf("   B - Show Break points\n")
-	// fmt.Printf("   l - load a 403 file\n")
+	fmt.Printf("   l - load a 403 file\n")
 	fmt.Printf("   L - Load V4 file (for Bilal!)\n")
+	fmt.Printf("   v - inspect V4, 403, Intel HEX or S-record file\n")
+	fmt.Printf("   X - load Intel HEX or S-record file\n")
+	fmt.Printf("   x - export memory as Intel HEX or S-record\n")
 	fmt.Printf("   m - dump memory\n")
+	fmt.Printf("   P - patch memory\n")
+	fmt.Printf("   f - fill memory\n")
+	fmt.Printf("   C - copy memory\n")
+	fmt.Printf("   / - search memory for words or a string\n")
+	fmt.Printf("   = - compare memory\n")
+	fmt.Printf("   A - start or stop the memory access trace\n")
 	fmt.Printf("   d - display CPU status\n")
+	fmt.Printf("   I - display interrupt statistics\n")
+	fmt.Printf("   i - inject interrupt\n")
 	fmt.Printf("   c - clear break point\n")
 	fmt.Printf("   H - display History\n")
+	fmt.Printf("   F - filter History by address, opcode or register\n")
+	fmt.Printf("   K - show the last executions of an address\n")
+	fmt.Printf("   W - find when a condition became true in History\n")
+	fmt.Printf("   T - export History to a trace file\n")
+	fmt.Printf("   t - start or stop streaming a trace file\n")
 	fmt.Printf("   p - Set PC\n")
 	fmt.Printf("   R - reset computer\n")
 	fmt.Printf("   q - quit the simulator\n")
 }
 
 func main() {
+	configFile := flag.String("config", "", "JSON machine description (see machine.json); default is to ask")
+	flag.BoolVar(&consoleTelnet, "telnet", false, "negotiate telnet options on the console (with -config use the telnet setting)")
+	flag.IntVar(&consoleObserverPort, "observerport", 0, "TCP port for read-only console observers e.g. 5001; default is none (with -config use the observerPort setting)")
+	flag.StringVar(&romFile, "rom", "", "ROM image file; default is the built in loader")
+	flag.StringVar(&romFormat, "romformat", "", "ROM image format: hex, binary or v4; default is to guess")
+	loadFileName := flag.String("load", "", "V4, 403, Intel HEX or S-record file to load before the menu starts")
+	loadFormat := flag.String("loadformat", "", "format of the -load file: v4, 403, ihex or srec; default is to detect")
+	loadAddress := flag.String("loadaddress", fmt.Sprintf("%04X", loader.Default403LoadAddress), "hex address 403 files are loaded at")
+	addressingName := flag.String("addressing", "word", "whether Intel HEX and S-record addresses are word or byte addresses")
+	inspectFileName := flag.String("inspect", "", "describe an image file and exit")
+	historySize := flag.Int("history", cpu.DefaultHistorySize, "number of instructions remembered in the History")
+	traceFileName := flag.String("trace", "", "stream every instruction executed to this trace file")
+	traceFormat := flag.String("traceformat", trace.JSONLFormat, "format of the -trace file: jsonl or binary")
+	flag.Parse()
+
+	if *historySize != cpu.History.Size() {
+		if err := cpu.History.SetSize(*historySize); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	addressing, err := loader.ParseAddressing(*addressingName)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	n, err := strconv.ParseUint(*loadAddress, 16, 32)
+	if err != nil || n > loader.MaxWordAddress {
+		fmt.Printf("invalid 403 load address %s\n", *loadAddress)
+		os.Exit(1)
+	}
+	load403Address = uint32(n)
+	options := loader.Options{Addressing: addressing, LoadAddress403: load403Address}
+
+	if *inspectFileName != "" {
+		if err := inspectFile(*inspectFileName, options); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	Init()
+	if *configFile == "" {
+		Init()
+	} else {
+		machine, err := config.Load(*configFile)
+		if err != nil {
+			fmt.Printf("Invalid machine description:\n%v\n", err)
+			os.Exit(1)
+		}
+		InitFromConfig(machine)
+	}
+
+	if *loadFileName != "" {
+		if err := loadFile(*loadFileName, *loadFormat, options); err != nil {
+			fmt.Printf("Could not load file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *traceFileName != "" {
+		if err := startTrace(*traceFileName, *traceFormat); err != nil {
+			fmt.Printf("Could not start trace: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	defer stopTrace()
 
 	for {
 		selection := cli.RawInput("Enter menu choice >")
@@ -391,13 +698,54 @@ func main() {
 			continue
 		}
 
+		if selection == "A" {
+			toggleAccessTrace()
+			continue
+		}
+
+		if selection == "F" || selection == "K" || selection == "W" {
+			queryHistory(selection)
+			continue
+		}
+
+		if selection == "T" {
+			exportHistory()
+			continue
+		}
+
+		if selection == "t" {
+			toggleTrace()
+			continue
+		}
+
 		if selection == "b" {
 			mycpu.SetBreakPoint()
 			continue
 		}
 
 		if selection == "L" {
-			loadV4File()
+			fileName := cli.RawInput("Enter V4 file name >")
+			if err := loadFile(fileName, loader.FormatV4, loader.Options{}); err != nil {
+				fmt.Printf("Could not load V4 file: %v\n", err)
+			}
+			continue
+		}
+
+		if selection == "v" {
+			fileName := cli.RawInput("Enter file name >")
+			if err := inspectFile(fileName, loader.Options{LoadAddress403: load403Address}); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+			continue
+		}
+
+		if selection == "X" {
+			loadHexFile()
+			continue
+		}
+
+		if selection == "x" {
+			exportMemory()
 			continue
 		}
 
@@ -421,6 +769,16 @@ func main() {
 			continue
 		}
 
+		if selection == "i" {
+			injectInterrupt()
+			continue
+		}
+
+		if selection == "I" {
+			interruptController1.ShowStatistics()
+			continue
+		}
+
 		if selection == "r" {
 			wg.Add(1)
 			go runSimulator(0)
@@ -435,10 +793,13 @@ func main() {
 			continue
 		}
 
-		// if selection == "l" {
-		// 	load403File()
-		// 	continue
-		// }
+		if selection == "l" {
+			fileName := cli.RawInput("Enter 403 file name >")
+			if err := loadFile(fileName, loader.Format403, loader.Options{LoadAddress403: load403Address}); err != nil {
+				fmt.Printf("Could not load 403 file: %v\n", err)
+			}
+			continue
+		}
 
 		if selection == "s" {
 			wg.Add(1)
@@ -453,6 +814,31 @@ func main() {
 			continue
 		}
 
+		if selection == "P" {
+			mem.Patch()
+			continue
+		}
+
+		if selection == "f" {
+			mem.FillMemory()
+			continue
+		}
+
+		if selection == "C" {
+			mem.CopyMemory()
+			continue
+		}
+
+		if selection == "/" {
+			mem.SearchMemory()
+			continue
+		}
+
+		if selection == "=" {
+			mem.CompareMemory()
+			continue
+		}
+
 		if selection == "S" {
 			showStacks()
 		}
@@ -0,0 +1,118 @@
+package interruptcontroller
+
+import (
+	"fmt"
+	"sort"
+)
+
+// UntilCleared may be given as numTicks to Inject and ScheduleInjection.
+// The input then stays asserted until software clears its status bit.
+const UntilCleared = 0
+
+// scheduledInjection is an injection which starts at a given tick
+type scheduledInjection struct {
+	atTick       uint64
+	interruptNum int
+	numTicks     uint64
+}
+
+// injection lets the debugger or a test harness assert interrupt
+// inputs without provoking the real source
+type injection struct {
+	ticksLeft    [16]uint64
+	untilCleared uint16
+	scheduled    []scheduledInjection
+}
+
+// start asserts interruptNum now
+func (j *injection) start(interruptNum int, numTicks uint64) {
+	if numTicks == UntilCleared {
+		j.untilCleared |= 1 << interruptNum
+		return
+	}
+	j.ticksLeft[interruptNum] = numTicks
+}
+
+// tick starts any scheduled injections which are due and
+// returns the inputs asserted by injection on this tick
+func (j *injection) tick(now uint64) uint16 {
+	for len(j.scheduled) > 0 && j.scheduled[0].atTick <= now {
+		j.start(j.scheduled[0].interruptNum, j.scheduled[0].numTicks)
+		j.scheduled = j.scheduled[1:]
+	}
+
+	asserted := j.untilCleared
+	for n := range j.ticksLeft {
+		if j.ticksLeft[n] == 0 {
+			continue
+		}
+		asserted |= 1 << n
+		j.ticksLeft[n]--
+	}
+	return asserted
+}
+
+// cleared ends until cleared injections for the bits in mask
+func (j *injection) cleared(mask uint16) {
+	j.untilCleared &^= mask
+}
+
+// checkInterruptNum makes sure interruptNum names an input
+func checkInterruptNum(interruptNum int) error {
+	if interruptNum < 0 || interruptNum > 15 {
+		return fmt.Errorf("interrupt number %d is not between 0 and 15", interruptNum)
+	}
+	return nil
+}
+
+// Inject asserts input interruptNum, starting with the next Tick, for
+// numTicks ticks or (numTicks == UntilCleared) until its status is cleared.
+// The injected signal is ORed with the input's callback.
+func (i *InterruptController) Inject(interruptNum int, numTicks uint64) error {
+	if err := checkInterruptNum(interruptNum); err != nil {
+		return err
+	}
+	i.injection.start(interruptNum, numTicks)
+	return nil
+}
+
+// ScheduleInjection is like Inject but starts at tick atTick
+// (see CurrentTick) so tests are reproducible.
+func (i *InterruptController) ScheduleInjection(atTick uint64, interruptNum int, numTicks uint64) error {
+	if err := checkInterruptNum(interruptNum); err != nil {
+		return err
+	}
+	j := &i.injection
+	j.scheduled = append(j.scheduled, scheduledInjection{atTick: atTick, interruptNum: interruptNum, numTicks: numTicks})
+	sort.SliceStable(j.scheduled, func(a, b int) bool {
+		return j.scheduled[a].atTick < j.scheduled[b].atTick
+	})
+	return nil
+}
+
+// ClearInjections cancels all active and scheduled injections
+func (i *InterruptController) ClearInjections() {
+	i.injection = injection{}
+}
+
+// CurrentTick returns the number of ticks the controller has seen
+func (i *InterruptController) CurrentTick() uint64 {
+	return i.numTicks
+}
+
+// ShowInjections prints active and scheduled injections
+func (i *InterruptController) ShowInjections() {
+	j := &i.injection
+	fmt.Printf("Interrupt injections at tick %d\n", i.numTicks)
+	for n := range j.ticksLeft {
+		if j.untilCleared&(1<<n) != 0 {
+			fmt.Printf("  input %2d asserted until cleared\n", n)
+		}
+		if j.ticksLeft[n] != 0 {
+			fmt.Printf("  input %2d asserted for %d more ticks\n", n, j.ticksLeft[n])
+		}
+	}
+	for _, s := range j.scheduled {
+		fmt.Printf("  input %2d scheduled at tick %d for %d ticks (0 = until cleared)\n", s.interruptNum, s.atTick, s.numTicks)
+	}
+}
@@ -0,0 +1,63 @@
+package interruptcontroller
+
+import "testing"
+
+func TestScheduledInjectionRaisesOnItsTick(t *testing.T) {
+	var i InterruptController
+	i.Init()
+	i.Write(maskAddress, 0x0008)
+	for n := 0; n < 3; n++ {
+		i.Tick()
+	}
+
+	at := i.CurrentTick() + 5
+	if err := i.ScheduleInjection(at, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var raisedAt []uint64
+	for n := 0; n < 10; n++ {
+		i.Tick()
+		if i.GetOutput() {
+			raisedAt = append(raisedAt, i.CurrentTick())
+			if status := i.Read(statusAddress); status != 0x0008 {
+				t.Fatalf("tick %d: status %04X; want 0008", i.CurrentTick(), status)
+			}
+			i.Write(clearAddress, 0x0008)
+		}
+	}
+
+	if len(raisedAt) != 2 || raisedAt[0] != at || raisedAt[1] != at+1 {
+		t.Fatalf("interrupt raised on ticks %v; want [%d %d]", raisedAt, at, at+1)
+	}
+}
+
+func TestScheduledInjectionsRunInTickOrder(t *testing.T) {
+	var i InterruptController
+	i.Init()
+	i.Write(maskAddress, 0x0003)
+	if err := i.ScheduleInjection(4, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ScheduleInjection(2, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[uint64]uint16{2: 0x0001, 4: 0x0002}
+	for n := 0; n < 6; n++ {
+		i.Tick()
+		if status := i.Read(statusAddress); status != want[i.CurrentTick()] {
+			t.Fatalf("tick %d: status %04X; want %04X", i.CurrentTick(), status, want[i.CurrentTick()])
+		}
+		i.Write(clearAddress, 0xFFFF)
+	}
+}
+
+func TestScheduleInjectionRejectsBadInput(t *testing.T) {
+	var i InterruptController
+	for _, n := range []int{-1, 16} {
+		if err := i.ScheduleInjection(1, n, 1); err == nil {
+			t.Errorf("scheduling input %d did not fail", n)
+		}
+	}
+}
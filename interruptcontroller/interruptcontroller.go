@@ -1,11 +1,43 @@
 package interruptcontroller
 
-import "fmt"
+import (
+	"albert_go_sim/device"
+	"fmt"
+)
+
+const (
+	statusAddress         = 0
+	maskAddress           = 1
+	clearAddress          = 2
+	controlAddress        = 3
+	highestPendingAddress = 4
+	acknowledgeAddress    = 5
+	selectAddress         = 6
+	vectorAddress         = 7
+	priorityAddress       = 8
+	edgeAddress           = 9
+)
 
+// Control register bits
 const (
-	statusAddress = 0
-	maskAddress   = 1
-	clearAddress  = 2
+	// ControlVectored makes the acknowledge cycle return the vector of
+	// the highest priority pending source (and clear it) instead of 0xFD00
+	ControlVectored = 0x0001
+	// ControlProgrammablePriority uses the priority registers instead
+	// of the fixed priority (lower source number wins)
+	ControlProgrammablePriority = 0x0002
+	// ControlExtended only makes registers 4-9 addressable.  Any
+	// other control bit does that too.
+	ControlExtended = 0x0004
+)
+
+const (
+	// DefaultVector is where the cpu goes for every interrupt
+	// when vectored mode is off
+	DefaultVector = 0xFD00
+	// NonePending is read from the highest pending register
+	// when no unmasked interrupt is pending
+	NonePending = 0xFFFF
 )
 
 type interruptCallbackFunction = func() bool
@@ -20,40 +52,124 @@ type InterruptController struct {
 	clear           uint16
 	Callbacks       [16]interruptCallbackFunction
 	outputIsBlocked bool
+	control         uint16
+	selected        uint16
+	vectors         [16]uint16
+	priorities      [16]uint16
+	// edge has a 1 for each input which is edge triggered.
+	// 0 (the reset value) means level triggered.
+	edge uint16
+	// previous holds each input as sampled on the previous tick
+	previous uint16
+	// InterruptsEnabled is optional.  When set it is used to
+	// measure how long the cpu runs with interrupts disabled.
+	InterruptsEnabled func() bool
+	statistics        statistics
+	// numTicks counts calls to Tick; it is the time base for
+	// statistics and scheduled injections
+	numTicks  uint64
+	injection injection
 }
 
-// limitAddress captures just the lower two bits
-// of an address because the interrupt controller
-// only has 3 addresses
-func limitAddress(a uint32) uint32 {
-	return a & 0x0003
+// limitAddress decodes an address.  With the control register 0 the
+// controller behaves like the original one, which only decoded the
+// lower two bits, so e.g. 4 is the status register again.
+// Once a control bit is set all four bits are decoded, so the
+// registers at 4-9 (highest pending, acknowledge, select, vector,
+// priority and edge) can be reached.
+func (i *InterruptController) limitAddress(a uint32) uint32 {
+	if i.control == 0 {
+		return a & 0x0003
+	}
+	return a & 0x000F
 }
 
 // Init the interrupt controller
 func (i *InterruptController) Init() {
 	fmt.Printf("Initializing interrupt controller\n")
+	for n := range i.vectors {
+		i.vectors[n] = DefaultVector
+		i.priorities[n] = uint16(n)
+	}
+}
+
+// HighestPending returns the number of the highest priority pending
+// source or NonePending.  Ties in programmable priority go to the
+// lower source number.
+func (i *InterruptController) HighestPending() uint16 {
+	highest := uint16(NonePending)
+	for n := 0; n < 16; n++ {
+		if i.status&(1<<n) == 0 {
+			continue
+		}
+		if highest == NonePending {
+			highest = uint16(n)
+			continue
+		}
+		if i.control&ControlProgrammablePriority != 0 && i.priorities[n] < i.priorities[highest] {
+			highest = uint16(n)
+		}
+	}
+	return highest
+}
+
+// Acknowledge is the interrupt acknowledge cycle.  It is meant to be
+// used as a callback by the cpu when it takes an interrupt and
+// returns the address of the service routine.
+// In vectored mode the acknowledged source is cleared from status.
+func (i *InterruptController) Acknowledge() uint16 {
+	if i.control&ControlVectored == 0 {
+		return DefaultVector
+	}
+	highest := i.HighestPending()
+	if highest == NonePending {
+		// Spurious; the source went away.  Let the default ISR sort it out.
+		return DefaultVector
+	}
+	i.status &^= 1 << highest
+	i.injection.cleared(1 << highest)
+	return i.vectors[highest]
 }
 
 // Tick should be called on every tick off the virtual clock
 // The hardware interrupt controller polls all of the interrupt
 // sources on every clock tick.
+// A level triggered input latches on every tick it is high.
+// An edge triggered input latches only when it goes from low to high,
+// so clearing it in status keeps it clear until the next edge.
 func (i *InterruptController) Tick() {
+	i.numTicks++
+	if i.InterruptsEnabled != nil {
+		i.statistics.noteInterruptsEnabled(i.InterruptsEnabled())
+	}
+	injected := i.injection.tick(i.numTicks)
 
-	for interruptNum := 0; interruptNum < 15; interruptNum++ {
+	for interruptNum := 0; interruptNum < 16; interruptNum++ {
+		bit := uint16(1 << interruptNum)
+		isInjected := injected&bit != 0
 		// Was a callback defined?
-		if i.Callbacks[interruptNum] == nil {
+		if i.Callbacks[interruptNum] == nil && !isInjected {
 			continue
 		}
-		// Does callback indicate an interrupt occurred?
-		if !(i.Callbacks[interruptNum]()) {
+		// Does callback (or injection) indicate an interrupt occurred?
+		wasHigh := i.previous&bit != 0
+		if !isInjected && !(i.Callbacks[interruptNum]()) {
+			i.previous &^= bit
+			continue
+		}
+		i.previous |= bit
+		if i.edge&bit != 0 && wasHigh {
 			continue
 		}
 		// Does mask allow capturing this interrupt
-		mask := (1 << interruptNum) & i.mask
+		mask := bit & i.mask
 		if mask == 0 {
 			continue
 		}
 		// If we got this far, we update the status to indicate an int occurred
+		if i.status&mask == 0 {
+			i.statistics.noteLatched(interruptNum, i.numTicks)
+		}
 		i.status |= mask
 	}
 }
@@ -70,7 +186,7 @@ func (i *InterruptController) GetOutput() bool {
 // Addresses are defined above
 func (i *InterruptController) Read(address uint32) uint16 {
 
-	address &= 0x0003
+	address = i.limitAddress(address)
 	if address == statusAddress {
 		return i.status
 	}
@@ -80,21 +196,58 @@ func (i *InterruptController) Read(address uint32) uint16 {
 	if address == clearAddress {
 		return i.clear
 	}
+	if address == controlAddress {
+		return i.control
+	}
+	if address == highestPendingAddress {
+		return i.HighestPending()
+	}
+	if address == acknowledgeAddress {
+		return i.Acknowledge()
+	}
+	if address == selectAddress {
+		return i.selected
+	}
+	if address == vectorAddress {
+		return i.vectors[i.selected]
+	}
+	if address == priorityAddress {
+		return i.priorities[i.selected]
+	}
+	if address == edgeAddress {
+		return i.edge
+	}
 
 	return 0
 }
 
 // Write takes an address and a value
 func (i *InterruptController) Write(address uint32, value uint16) {
-	address = limitAddress(address)
+	address = i.limitAddress(address)
 	if address == clearAddress {
 		i.clear = value
 		i.status = i.status &^ i.clear
+		i.injection.cleared(i.clear)
 		return
 	}
 	if address == maskAddress {
 		i.mask = value
 	}
+	if address == controlAddress {
+		i.control = value
+	}
+	if address == selectAddress {
+		i.selected = value & 0x000F
+	}
+	if address == vectorAddress {
+		i.vectors[i.selected] = value
+	}
+	if address == priorityAddress {
+		i.priorities[i.selected] = value
+	}
+	if address == edgeAddress {
+		i.edge = value
+	}
 }
 
 // ShowStatus shows the values in the int controller registers
@@ -103,6 +256,28 @@ func (i *InterruptController) ShowStatus() {
 	fmt.Printf("  mask   : %04X\n", i.mask)
 	fmt.Printf("  status : %04X\n", i.status)
 	fmt.Printf("  clear  : %04X\n", i.clear)
+	fmt.Printf("  control: %04X\n", i.control)
+	fmt.Printf("  highest: %04X\n", i.HighestPending())
+	fmt.Printf("  edge   : %04X\n", i.edge)
 	fmt.Printf("  ouput  : %v\n", i.GetOutput())
 
 }
+
+// Name returns the name of the device
+func (i *InterruptController) Name() string {
+	return "Interrupt Controller"
+}
+
+// Reset clears the statistics and any interrupt injections.
+// Like the hardware, status and mask survive a reset.
+func (i *InterruptController) Reset() {
+	i.ClearStatistics()
+	i.ClearInjections()
+}
+
+// Interrupts returns the controller's single output
+func (i *InterruptController) Interrupts() []device.Interrupt {
+	return []device.Interrupt{
+		{Name: "Output", Asserted: i.GetOutput},
+	}
+}
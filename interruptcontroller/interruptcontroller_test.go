@@ -0,0 +1,140 @@
+package interruptcontroller
+
+import "testing"
+
+// newTestController returns a controller with input 0 driven by
+// *input and unmasked.  isEdge makes input 0 edge triggered.
+func newTestController(input *bool, isEdge bool) *InterruptController {
+	var i InterruptController
+	i.Init()
+	i.Callbacks[0] = func() bool { return *input }
+	i.Write(maskAddress, 0x0001)
+	if isEdge {
+		i.Write(controlAddress, ControlExtended)
+		i.Write(edgeAddress, 0x0001)
+	}
+	return &i
+}
+
+func TestEdgeInputHeldHighStaysClear(t *testing.T) {
+	input := true
+	i := newTestController(&input, true)
+
+	i.Tick()
+	if i.Read(statusAddress) != 0x0001 {
+		t.Fatalf("rising edge did not latch; status %04X", i.Read(statusAddress))
+	}
+
+	i.Write(clearAddress, 0x0001)
+	for n := 0; n < 10; n++ {
+		i.Tick()
+		if status := i.Read(statusAddress); status != 0 {
+			t.Fatalf("input held high re-latched after clear on tick %d; status %04X", n, status)
+		}
+	}
+}
+
+func TestEdgeInputLatchesOnNextRisingEdge(t *testing.T) {
+	input := true
+	i := newTestController(&input, true)
+
+	i.Tick()
+	i.Write(clearAddress, 0x0001)
+
+	input = false
+	i.Tick()
+	if status := i.Read(statusAddress); status != 0 {
+		t.Fatalf("low input latched; status %04X", status)
+	}
+
+	input = true
+	i.Tick()
+	if status := i.Read(statusAddress); status != 0x0001 {
+		t.Fatalf("new rising edge did not latch; status %04X", status)
+	}
+}
+
+func TestLevelInputStillHighLatchesAfterClear(t *testing.T) {
+	input := true
+	i := newTestController(&input, false)
+
+	i.Tick()
+	i.Write(clearAddress, 0x0001)
+	if status := i.Read(statusAddress); status != 0 {
+		t.Fatalf("clear did not clear status; status %04X", status)
+	}
+
+	i.Tick()
+	if status := i.Read(statusAddress); status != 0x0001 {
+		t.Fatalf("level input still high did not re-latch; status %04X", status)
+	}
+}
+
+func TestVectoredAcknowledgeEndsUntilClearedInjection(t *testing.T) {
+	var i InterruptController
+	i.Init()
+	i.Write(maskAddress, 0x0004)
+	i.Write(controlAddress, ControlVectored)
+	if err := i.Inject(2, UntilCleared); err != nil {
+		t.Fatal(err)
+	}
+
+	i.Tick()
+	if status := i.Read(statusAddress); status != 0x0004 {
+		t.Fatalf("injection did not latch; status %04X", status)
+	}
+	i.Acknowledge()
+
+	i.Tick()
+	if status := i.Read(statusAddress); status != 0 {
+		t.Fatalf("injection re-asserted after acknowledge; status %04X", status)
+	}
+}
+
+func TestAddressDecoding(t *testing.T) {
+	var i InterruptController
+	i.Init()
+
+	// With control 0 only two bits are decoded, as on the original
+	i.Write(maskAddress+4, 0x0012)
+	if mask := i.Read(maskAddress); mask != 0x0012 {
+		t.Fatalf("write to 5 did not reach the mask; mask %04X", mask)
+	}
+	i.Write(edgeAddress, 0x0034)
+	if mask := i.Read(maskAddress); mask != 0x0034 {
+		t.Fatalf("write to 9 did not reach the mask; mask %04X", mask)
+	}
+	if edge := i.edge; edge != 0 {
+		t.Fatalf("edge is reachable with control 0; edge %04X", edge)
+	}
+
+	// Any control bit decodes all four
+	i.Write(controlAddress, ControlExtended)
+	i.Write(selectAddress, 3)
+	i.Write(vectorAddress, 0xFC30)
+	i.Write(priorityAddress, 7)
+	i.Write(edgeAddress, 0x0008)
+	if mask := i.Read(maskAddress); mask != 0x0034 {
+		t.Fatalf("registers 6-9 alias onto the mask; mask %04X", mask)
+	}
+	if control := i.Read(controlAddress); control != ControlExtended {
+		t.Fatalf("registers 6-9 alias onto control; control %04X", control)
+	}
+	if v := i.Read(vectorAddress); v != 0xFC30 {
+		t.Fatalf("vector 3 is %04X; want FC30", v)
+	}
+	if p := i.Read(priorityAddress); p != 7 {
+		t.Fatalf("priority 3 is %d; want 7", p)
+	}
+	if e := i.Read(edgeAddress + 0x10); e != 0x0008 {
+		t.Fatalf("edge at 19 is %04X; want 0008", e)
+	}
+	if h := i.Read(highestPendingAddress); h != NonePending {
+		t.Fatalf("highest pending is %04X with nothing pending", h)
+	}
+
+	i.Write(controlAddress, 0)
+	if mask := i.Read(acknowledgeAddress); mask != 0x0034 {
+		t.Fatalf("5 is not the mask after control is cleared; read %04X", mask)
+	}
+}
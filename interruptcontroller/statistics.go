@@ -0,0 +1,158 @@
+package interruptcontroller
+
+import "fmt"
+
+// sourceStatistics is what we know about a single interrupt input
+type sourceStatistics struct {
+	numAssertions  uint64
+	numServiced    uint64
+	assertedAt     uint64
+	isWaiting      bool
+	totalLatency   uint64
+	maxLatency     uint64
+	totalISRTicks  uint64
+	maxISRTicks    uint64
+	numISRReturned uint64
+}
+
+// isrFrame remembers an interrupt service routine in progress
+type isrFrame struct {
+	startedAt uint64
+	sources   uint16
+}
+
+// statistics is kept by the interrupt controller.  All times are in
+// clock ticks as seen by InterruptController.Tick.
+type statistics struct {
+	startedAt          uint64
+	sources            [16]sourceStatistics
+	isrStack           []isrFrame
+	numNested          uint64
+	maxDepth           int
+	numSpuriousRETI    uint64
+	ticksDisabled      uint64
+	longestDisabled    uint64
+	currentDisabled    uint64
+	numInterruptsTaken uint64
+}
+
+// noteLatched is called when a source sets its status bit
+func (s *statistics) noteLatched(interruptNum int, now uint64) {
+	source := &s.sources[interruptNum]
+	source.numAssertions++
+	if !source.isWaiting {
+		source.isWaiting = true
+		source.assertedAt = now
+	}
+}
+
+// noteInterruptsEnabled tracks time spent with the cpu's interrupts disabled
+func (s *statistics) noteInterruptsEnabled(enabled bool) {
+	if enabled {
+		s.currentDisabled = 0
+		return
+	}
+	s.ticksDisabled++
+	s.currentDisabled++
+	if s.currentDisabled > s.longestDisabled {
+		s.longestDisabled = s.currentDisabled
+	}
+}
+
+// InterruptTaken is meant to be used as a callback by the cpu
+// when it executes JSRINT.  It must be called before Acknowledge.
+func (i *InterruptController) InterruptTaken() {
+	s := &i.statistics
+	s.numInterruptsTaken++
+	if len(s.isrStack) > 0 {
+		s.numNested++
+	}
+
+	// Every waiting source still pending is being serviced by this ISR.
+	// In vectored mode only the acknowledged source is.
+	serviced := i.status
+	if i.control&ControlVectored != 0 {
+		serviced = 0
+		if highest := i.HighestPending(); highest != NonePending {
+			serviced = 1 << highest
+		}
+	}
+
+	for n := range s.sources {
+		source := &s.sources[n]
+		if serviced&(1<<n) == 0 || !source.isWaiting {
+			continue
+		}
+		latency := i.numTicks - source.assertedAt
+		source.totalLatency += latency
+		if latency > source.maxLatency {
+			source.maxLatency = latency
+		}
+		source.numServiced++
+		source.isWaiting = false
+	}
+
+	s.isrStack = append(s.isrStack, isrFrame{startedAt: i.numTicks, sources: serviced})
+	if len(s.isrStack) > s.maxDepth {
+		s.maxDepth = len(s.isrStack)
+	}
+}
+
+// InterruptReturned is meant to be used as a callback by the cpu
+// when it executes RETI
+func (i *InterruptController) InterruptReturned() {
+	s := &i.statistics
+	if len(s.isrStack) == 0 {
+		// e.g. RETI used to return from SYSCALL
+		s.numSpuriousRETI++
+		return
+	}
+	frame := s.isrStack[len(s.isrStack)-1]
+	s.isrStack = s.isrStack[:len(s.isrStack)-1]
+
+	duration := i.numTicks - frame.startedAt
+	for n := range s.sources {
+		if frame.sources&(1<<n) == 0 {
+			continue
+		}
+		source := &s.sources[n]
+		source.totalISRTicks += duration
+		source.numISRReturned++
+		if duration > source.maxISRTicks {
+			source.maxISRTicks = duration
+		}
+	}
+}
+
+// ClearStatistics starts collecting interrupt statistics from scratch
+func (i *InterruptController) ClearStatistics() {
+	i.statistics = statistics{startedAt: i.numTicks}
+}
+
+// ShowStatistics prints the interrupt statistics report
+func (i *InterruptController) ShowStatistics() {
+	s := &i.statistics
+	fmt.Printf("Interrupt Statistics (times in ticks) after %d ticks\n", i.numTicks-s.startedAt)
+	fmt.Printf("  SRC  ASSERTED  SERVICED  AVG LATENCY  MAX LATENCY   AVG ISR   MAX ISR\n")
+	for n := range s.sources {
+		source := &s.sources[n]
+		if source.numAssertions == 0 {
+			continue
+		}
+		avgLatency := uint64(0)
+		if source.numServiced != 0 {
+			avgLatency = source.totalLatency / source.numServiced
+		}
+		avgISR := uint64(0)
+		if source.numISRReturned != 0 {
+			avgISR = source.totalISRTicks / source.numISRReturned
+		}
+		fmt.Printf("  %3d  %8d  %8d  %11d  %11d  %8d  %8d\n", n,
+			source.numAssertions, source.numServiced, avgLatency, source.maxLatency,
+			avgISR, source.maxISRTicks)
+	}
+	fmt.Printf("  Interrupts taken        : %d\n", s.numInterruptsTaken)
+	fmt.Printf("  Nested interrupts       : %d (max depth %d)\n", s.numNested, s.maxDepth)
+	fmt.Printf("  RETI without JSRINT     : %d\n", s.numSpuriousRETI)
+	fmt.Printf("  Ticks ints disabled     : %d (longest stretch %d)\n", s.ticksDisabled, s.longestDisabled)
+}
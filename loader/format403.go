@@ -0,0 +1,107 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Default403LoadAddress is where 403 images are loaded (hence the
+// name) unless another load address is given
+const Default403LoadAddress = 0x0403
+
+// Image403 is an image in Pat's original loader format from 2006.
+// The file is text; every word is 4 hex digits with no separators:
+// the number of words, the start address, then the words themselves.
+// A trailing line ending is allowed.
+type Image403 struct {
+	LoadAddress  uint32
+	StartAddress uint16
+	Words        []uint16
+}
+
+// trim403 removes a trailing line ending
+func trim403(data []byte) []byte {
+	for len(data) > 0 && (data[len(data)-1] == '\n' || data[len(data)-1] == '\r') {
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// is403 reports whether data looks like a 403 image
+func is403(data []byte) bool {
+	data = trim403(data)
+	if len(data) < 8 || len(data)%4 != 0 {
+		return false
+	}
+	for _, b := range data {
+		isHex := (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+		if !isHex {
+			return false
+		}
+	}
+	n, _ := strconv.ParseUint(string(data[0:4]), 16, 16)
+	return len(data) == 8+4*int(n)
+}
+
+// Parse403 decodes a 403 image which is loaded at loadAddress
+func Parse403(data []byte, loadAddress uint32) (*Image403, error) {
+	data = trim403(data)
+	word := func(i int) (uint16, error) {
+		s := string(data[4*i : 4*i+4])
+		n, err := strconv.ParseUint(s, 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("byte offset %d: %q is not 4 hex digits", 4*i, s)
+		}
+		return uint16(n), nil
+	}
+
+	if len(data) < 8 {
+		return nil, fmt.Errorf("403 file is %d bytes; too small for the 8 byte header", len(data))
+	}
+	objectLength, err := word(0)
+	if err != nil {
+		return nil, err
+	}
+	requiredSize := 8 + 4*int(objectLength)
+	if len(data) != requiredSize {
+		return nil, fmt.Errorf("403 file is %d bytes but its header says %d", len(data), requiredSize)
+	}
+
+	if uint64(loadAddress)+uint64(objectLength) > MaxWordAddress+1 {
+		return nil, fmt.Errorf("%04X words loaded at %05X run past the end of memory", objectLength, loadAddress)
+	}
+
+	image := Image403{LoadAddress: loadAddress}
+	if image.StartAddress, err = word(1); err != nil {
+		return nil, err
+	}
+	image.Words = make([]uint16, objectLength)
+	for i := range image.Words {
+		if image.Words[i], err = word(2 + i); err != nil {
+			return nil, err
+		}
+	}
+	return &image, nil
+}
+
+// Inspect prints the header
+func (f *Image403) Inspect(w io.Writer) {
+	fmt.Fprintf(w, "Object Length [%04X]\n", len(f.Words))
+	fmt.Fprintf(w, "Start Address [%04X]\n", f.StartAddress)
+	fmt.Fprintf(w, "Load Address  [%05X]\n", f.LoadAddress)
+}
+
+// LoadInto writes the words from LoadAddress on
+// and sets the PC to the start address.
+// Nothing is written unless every word fits in writable memory.
+func (f *Image403) LoadInto(m Machine) error {
+	if err := m.CheckWritable(f.LoadAddress, uint32(len(f.Words))); err != nil {
+		return err
+	}
+	for i, w := range f.Words {
+		m.Write(f.LoadAddress+uint32(i), w)
+	}
+	m.SetPC(f.StartAddress)
+	return nil
+}
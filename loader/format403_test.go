@@ -0,0 +1,62 @@
+package loader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse403(t *testing.T) {
+	image, err := Parse403([]byte("000204101234abcd\r\n"), Default403LoadAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Image403{LoadAddress: 0x0403, StartAddress: 0x0410, Words: []uint16{0x1234, 0xABCD}}
+	if !reflect.DeepEqual(*image, want) {
+		t.Fatalf("parsed %+v; want %+v", *image, want)
+	}
+	if !is403([]byte("000204101234abcd\n")) {
+		t.Fatalf("is403 did not recognise a 403 image")
+	}
+}
+
+func TestParse403Malformed(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		loadAddress uint32
+		wantErr     string
+	}{
+		{"empty", "", Default403LoadAddress, "too small"},
+		{"short header", "0001040", Default403LoadAddress, "too small"},
+		{"bad hex in length", "00G10403FFFF", Default403LoadAddress, "byte offset 0"},
+		{"bad hex in start", "00010x03FFFF", Default403LoadAddress, "byte offset 4"},
+		{"bad hex in word", "000204031234ZZZZ", Default403LoadAddress, "byte offset 12"},
+		{"sign in word", "00010403+FFF", Default403LoadAddress, "byte offset 8"},
+		{"short record", "00020403123", Default403LoadAddress, "header says 16"},
+		{"missing word", "000204031234", Default403LoadAddress, "header says 16"},
+		{"extra word", "0001040312345678", Default403LoadAddress, "header says 12"},
+		{"wraps past end of memory", "000200001234abcd", MaxWordAddress, "past the end of memory"},
+		{"starts past end of memory", "000100001234", MaxWordAddress + 1, "past the end of memory"},
+	}
+	for _, test := range tests {
+		_, err := Parse403([]byte(test.data), test.loadAddress)
+		if err == nil {
+			t.Errorf("%s: parsed without error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %q does not mention %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestParse403EndsAtLastAddress(t *testing.T) {
+	image, err := Parse403([]byte("000200001234abcd"), MaxWordAddress-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.LoadAddress+uint32(len(image.Words))-1 != MaxWordAddress {
+		t.Fatalf("image ends at %05X; want %05X", image.LoadAddress+uint32(len(image.Words))-1, MaxWordAddress)
+	}
+}
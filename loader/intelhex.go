@@ -0,0 +1,169 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Intel HEX record types
+const (
+	ihexData                   = 0x00
+	ihexEndOfFile              = 0x01
+	ihexExtendedSegmentAddress = 0x02
+	ihexStartSegmentAddress    = 0x03
+	ihexExtendedLinearAddress  = 0x04
+	ihexStartLinearAddress     = 0x05
+)
+
+// ihexBytesPerRecord is the number of data bytes in exported records
+const ihexBytesPerRecord = 16
+
+// ParseIntelHex decodes an Intel HEX file
+func ParseIntelHex(data []byte, addressing Addressing) (*WordImage, error) {
+	image := WordImage{Format: FormatIntelHex, Addressing: addressing}
+	builder := newWordBuilder(addressing)
+	base := uint32(0)
+	isEnded := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if isEnded {
+			return nil, fmt.Errorf("line %d: record after the end of file record", lineNum)
+		}
+		if line[0] != ':' {
+			return nil, fmt.Errorf("line %d: record does not start with ':'", lineNum)
+		}
+		record, err := hex.DecodeString(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if len(record) < 5 || len(record) != 5+int(record[0]) {
+			return nil, fmt.Errorf("line %d: record length does not match its byte count", lineNum)
+		}
+		sum := byte(0)
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: bad checksum", lineNum)
+		}
+
+		address := uint32(record[1])<<8 | uint32(record[2])
+		recordType := record[3]
+		payload := record[4 : len(record)-1]
+		value := uint32(0)
+		for _, b := range payload {
+			value = value<<8 | uint32(b)
+		}
+
+		switch recordType {
+		case ihexData:
+			if err := builder.add(base+address, payload); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+		case ihexEndOfFile:
+			isEnded = true
+		case ihexExtendedSegmentAddress, ihexExtendedLinearAddress:
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("line %d: address record needs 2 data bytes", lineNum)
+			}
+			if recordType == ihexExtendedSegmentAddress {
+				base = value << 4
+			} else {
+				base = value << 16
+			}
+		case ihexStartSegmentAddress, ihexStartLinearAddress:
+			if len(payload) != 4 {
+				return nil, fmt.Errorf("line %d: start address record needs 4 data bytes", lineNum)
+			}
+			if recordType == ihexStartSegmentAddress {
+				value = (value>>16)<<4 + value&0xFFFF
+			}
+			image.HasStartAddress = true
+			image.StartAddress = addressing.wordAddress(value)
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %02X", lineNum, recordType)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !isEnded {
+		return nil, fmt.Errorf("no end of file record")
+	}
+
+	segments, err := builder.segments()
+	if err != nil {
+		return nil, err
+	}
+	image.Segments = segments
+	return &image, nil
+}
+
+// writeIntelHexRecord writes one record with its checksum
+func writeIntelHexRecord(w io.Writer, address uint16, recordType byte, payload []byte) error {
+	record := append([]byte{byte(len(payload)), byte(address >> 8), byte(address), recordType}, payload...)
+	sum := byte(0)
+	for _, b := range record {
+		sum += b
+	}
+	record = append(record, -sum)
+	_, err := fmt.Fprintf(w, ":%s\n", strings.ToUpper(hex.EncodeToString(record)))
+	return err
+}
+
+// ExportIntelHex writes length words of memory from start as Intel HEX.
+// Extended linear address records are used for addresses beyond FFFF.
+func ExportIntelHex(w io.Writer, read func(address uint32) uint16, start uint32, length uint32, addressing Addressing) error {
+	words, err := readWords(read, start, length)
+	if err != nil {
+		return err
+	}
+
+	address := start
+	if addressing == ByteAddressing {
+		address *= 2
+	}
+	upper := uint32(0)
+	data := wordsToBytes(words)
+	for len(data) > 0 {
+		n := ihexBytesPerRecord
+		if n > len(data) {
+			n = len(data)
+		}
+		// A record may not cross a 64K boundary
+		if room := 0x10000 - address&0xFFFF; addressing == ByteAddressing && uint32(n) > room {
+			n = int(room)
+		} else if addressing == WordAddressing && uint32(n/2) > room {
+			n = int(2 * room)
+		}
+
+		if address>>16 != upper {
+			upper = address >> 16
+			if err := writeIntelHexRecord(w, 0, ihexExtendedLinearAddress, []byte{byte(upper >> 8), byte(upper)}); err != nil {
+				return err
+			}
+		}
+		if err := writeIntelHexRecord(w, uint16(address), ihexData, data[:n]); err != nil {
+			return err
+		}
+
+		data = data[n:]
+		if addressing == ByteAddressing {
+			address += uint32(n)
+		} else {
+			address += uint32(n / 2)
+		}
+	}
+	return writeIntelHexRecord(w, 0, ihexEndOfFile, nil)
+}
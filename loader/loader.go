@@ -0,0 +1,96 @@
+// Package loader loads program images into the simulated machine.
+// The format of an image can be given or detected from its contents.
+package loader
+
+import (
+	"albert_go_sim/v4"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Image formats
+const (
+	FormatV4       = "v4"
+	Format403      = "403"
+	FormatIntelHex = "ihex"
+	FormatSRecord  = "srec"
+)
+
+// Machine is what an image is loaded into
+type Machine = v4.Machine
+
+// Image is a parsed program image
+type Image interface {
+	// LoadInto writes the image to memory and sets the PC
+	LoadInto(m Machine) error
+	// Inspect prints a description of the image
+	Inspect(w io.Writer)
+}
+
+// Detect decides the format of data from its contents
+func Detect(data []byte) (string, error) {
+	if v4.IsV4(data) {
+		return FormatV4, nil
+	}
+	if is403(data) {
+		return Format403, nil
+	}
+	text := bytes.TrimSpace(data)
+	if len(text) > 0 && text[0] == ':' {
+		return FormatIntelHex, nil
+	}
+	if len(text) > 1 && text[0] == 'S' && text[1] >= '0' && text[1] <= '9' {
+		return FormatSRecord, nil
+	}
+	return "", fmt.Errorf("not a V4, 403, Intel HEX or S-record image")
+}
+
+// Options control how images are decoded
+type Options struct {
+	// Addressing only matters for Intel HEX and S-records
+	Addressing Addressing
+	// LoadAddress403 is where 403 images are loaded.
+	// 0 means Default403LoadAddress.
+	LoadAddress403 uint32
+}
+
+// Parse decodes data in format or, if format is empty, the detected format.
+func Parse(data []byte, format string, options Options) (Image, error) {
+	if format == "" {
+		var err error
+		format, err = Detect(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch format {
+	case FormatV4:
+		return v4.Parse(data)
+	case Format403:
+		loadAddress := options.LoadAddress403
+		if loadAddress == 0 {
+			loadAddress = Default403LoadAddress
+		}
+		return Parse403(data, loadAddress)
+	case FormatIntelHex:
+		return ParseIntelHex(data, options.Addressing)
+	case FormatSRecord:
+		return ParseSRecord(data, options.Addressing)
+	}
+	return nil, fmt.Errorf("unknown image format %q", format)
+}
+
+// ReadFile reads and parses the image in fileName
+func ReadFile(fileName string, format string, options Options) (Image, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	image, err := Parse(data, format, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return image, nil
+}
@@ -0,0 +1,72 @@
+package loader
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testMachine has RAM from 00400 to 0EFFF and nothing else
+type testMachine struct {
+	written map[uint32]uint16
+	pc      uint16
+}
+
+func newTestMachine() *testMachine {
+	return &testMachine{written: make(map[uint32]uint16)}
+}
+
+func (m *testMachine) CheckWritable(start uint32, count uint32) error {
+	for i := uint32(0); i < count; i++ {
+		if start+i < 0x00400 || start+i > 0x0EFFF {
+			return fmt.Errorf("address %05X is not RAM", start+i)
+		}
+	}
+	return nil
+}
+
+func (m *testMachine) Write(address uint32, value uint16) {
+	if m.CheckWritable(address, 1) != nil {
+		panic(fmt.Sprintf("write to %05X", address))
+	}
+	m.written[address] = value
+}
+
+func (m *testMachine) SetPC(pc uint16) {
+	m.pc = pc
+}
+
+func TestLoadIntoChecksWholeImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		format      string
+		loadAddress uint32 // for 403 images
+		ok          bool
+	}{
+		{"403 in RAM", "0002040312341234", Format403, 0, true},
+		{"403 into ROM", "0002040312341234", Format403, 0x03FF, false},
+		{"v4 in RAM", "\x00\x00\x00\x04\x00\x01\x04\x00\x04\x00\x00\x01\x05\x00\x12\x34\x56\x78", FormatV4, 0, true},
+		{"v4 data over devices", "\x00\x00\x00\x04\x00\x01\x04\x00\x04\x00\x00\x01\xF0\x00\x12\x34\x56\x78", FormatV4, 0, false},
+		{"ihex in RAM", ":0404000012345678E4\n:00000001FF\n", FormatIntelHex, 0, true},
+		{"ihex second record runs off RAM", ":020400001234B4\n:04EFFF0056789ABCEA\n:00000001FF\n", FormatIntelHex, 0, false},
+	}
+	for _, test := range tests {
+		image, err := Parse([]byte(test.data), test.format, Options{LoadAddress403: test.loadAddress})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		m := newTestMachine()
+		err = image.LoadInto(m)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: loaded without error", test.name)
+			}
+			if len(m.written) != 0 {
+				t.Errorf("%s: %d words written before the error", test.name, len(m.written))
+			}
+		}
+	}
+}
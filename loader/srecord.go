@@ -0,0 +1,156 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// srecBytesPerRecord is the number of data bytes in exported records
+const srecBytesPerRecord = 16
+
+// srecAddressSize is the number of address bytes for each record type
+var srecAddressSize = map[byte]int{
+	'0': 2, '1': 2, '2': 3, '3': 4, '5': 2, '6': 3, '7': 4, '8': 3, '9': 2,
+}
+
+// ParseSRecord decodes a Motorola S-record file.
+// A termination record with address 0 means there is no start address.
+func ParseSRecord(data []byte, addressing Addressing) (*WordImage, error) {
+	image := WordImage{Format: FormatSRecord, Addressing: addressing}
+	builder := newWordBuilder(addressing)
+	numDataRecords := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(line) < 2 || line[0] != 'S' {
+			return nil, fmt.Errorf("line %d: record does not start with 'S'", lineNum)
+		}
+		recordType := line[1]
+		addressSize, ok := srecAddressSize[recordType]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown record type S%c", lineNum, recordType)
+		}
+		record, err := hex.DecodeString(line[2:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if len(record) < 1+addressSize+1 || len(record) != 1+int(record[0]) {
+			return nil, fmt.Errorf("line %d: record length does not match its byte count", lineNum)
+		}
+		sum := byte(0)
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0xFF {
+			return nil, fmt.Errorf("line %d: bad checksum", lineNum)
+		}
+
+		address := uint32(0)
+		for _, b := range record[1 : 1+addressSize] {
+			address = address<<8 | uint32(b)
+		}
+		payload := record[1+addressSize : len(record)-1]
+
+		switch recordType {
+		case '0':
+			// header; ignored
+		case '1', '2', '3':
+			numDataRecords++
+			if err := builder.add(address, payload); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+		case '5', '6':
+			if int(address) != numDataRecords {
+				return nil, fmt.Errorf("line %d: count record says %d data records but there are %d", lineNum, address, numDataRecords)
+			}
+		case '7', '8', '9':
+			if address == 0 {
+				break
+			}
+			image.HasStartAddress = true
+			image.StartAddress = addressing.wordAddress(address)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	segments, err := builder.segments()
+	if err != nil {
+		return nil, err
+	}
+	image.Segments = segments
+	return &image, nil
+}
+
+// writeSRecord writes one record with its byte count and checksum
+func writeSRecord(w io.Writer, recordType byte, address uint32, payload []byte) error {
+	addressSize := srecAddressSize[recordType]
+	record := []byte{byte(addressSize + len(payload) + 1)}
+	for i := addressSize - 1; i >= 0; i-- {
+		record = append(record, byte(address>>(8*uint(i))))
+	}
+	record = append(record, payload...)
+	sum := byte(0)
+	for _, b := range record {
+		sum += b
+	}
+	record = append(record, ^sum)
+	_, err := fmt.Fprintf(w, "S%c%s\n", recordType, strings.ToUpper(hex.EncodeToString(record)))
+	return err
+}
+
+// ExportSRecord writes length words of memory from start as S-records.
+// S2 records (24 bit addresses) are used since every address fits.
+func ExportSRecord(w io.Writer, read func(address uint32) uint16, start uint32, length uint32, addressing Addressing) error {
+	words, err := readWords(read, start, length)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSRecord(w, '0', 0, []byte("albert")); err != nil {
+		return err
+	}
+	address := start
+	if addressing == ByteAddressing {
+		address *= 2
+	}
+	numDataRecords := 0
+	data := wordsToBytes(words)
+	for len(data) > 0 {
+		n := srecBytesPerRecord
+		if n > len(data) {
+			n = len(data)
+		}
+		if err := writeSRecord(w, '2', address, data[:n]); err != nil {
+			return err
+		}
+		numDataRecords++
+		data = data[n:]
+		if addressing == ByteAddressing {
+			address += uint32(n)
+		} else {
+			address += uint32(n / 2)
+		}
+	}
+	if numDataRecords <= 0xFFFF {
+		if err := writeSRecord(w, '5', uint32(numDataRecords), nil); err != nil {
+			return err
+		}
+	} else {
+		if err := writeSRecord(w, '6', uint32(numDataRecords), nil); err != nil {
+			return err
+		}
+	}
+	return writeSRecord(w, '8', 0, nil)
+}
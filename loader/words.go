@@ -0,0 +1,203 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Addressing says what the addresses in Intel HEX and S-record
+// files count.  Memory is 16 bit words with 20 bit word addresses.
+type Addressing int
+
+const (
+	// WordAddressing - an address is a word address and
+	// each pair of data bytes is one big endian word
+	WordAddressing Addressing = iota
+	// ByteAddressing - an address is a byte address; byte
+	// address b is the high byte of word b/2 if b is even
+	// and the low byte if b is odd
+	ByteAddressing
+)
+
+// MaxWordAddress is the highest word address in the machine
+const MaxWordAddress = 0xFFFFF
+
+// ParseAddressing turns "word" or "byte" into an Addressing
+func ParseAddressing(s string) (Addressing, error) {
+	switch s {
+	case "", "word":
+		return WordAddressing, nil
+	case "byte":
+		return ByteAddressing, nil
+	}
+	return 0, fmt.Errorf("addressing %q is not word or byte", s)
+}
+
+// String returns "word" or "byte"
+func (a Addressing) String() string {
+	if a == ByteAddressing {
+		return "byte"
+	}
+	return "word"
+}
+
+// Segment is a run of words at consecutive addresses
+type Segment struct {
+	Address uint32
+	Words   []uint16
+}
+
+// WordImage is an image made of arbitrary segments, as read from
+// an Intel HEX or S-record file
+type WordImage struct {
+	Format          string
+	Addressing      Addressing
+	Segments        []Segment
+	HasStartAddress bool
+	StartAddress    uint32
+}
+
+// Half words written so far by a wordBuilder
+const (
+	highByte = 1
+	lowByte  = 2
+)
+
+// wordBuilder collects bytes from records into words
+type wordBuilder struct {
+	addressing Addressing
+	words      map[uint32]uint16
+	written    map[uint32]uint8
+}
+
+func newWordBuilder(addressing Addressing) *wordBuilder {
+	return &wordBuilder{
+		addressing: addressing,
+		words:      make(map[uint32]uint16),
+		written:    make(map[uint32]uint8),
+	}
+}
+
+// add stores the data from one record at address
+func (b *wordBuilder) add(address uint32, data []byte) error {
+	if b.addressing == WordAddressing {
+		if len(data)%2 != 0 {
+			return fmt.Errorf("%d data bytes is not a whole number of words", len(data))
+		}
+		for i := 0; i < len(data)/2; i++ {
+			wordAddress := address + uint32(i)
+			if wordAddress > MaxWordAddress {
+				return fmt.Errorf("word address %X is beyond %05X", wordAddress, MaxWordAddress)
+			}
+			b.words[wordAddress] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			b.written[wordAddress] = highByte | lowByte
+		}
+		return nil
+	}
+
+	for i, value := range data {
+		byteAddress := address + uint32(i)
+		wordAddress := byteAddress / 2
+		if wordAddress > MaxWordAddress {
+			return fmt.Errorf("byte address %X is beyond word %05X", byteAddress, MaxWordAddress)
+		}
+		if byteAddress%2 == 0 {
+			b.words[wordAddress] = b.words[wordAddress]&0x00FF | uint16(value)<<8
+			b.written[wordAddress] |= highByte
+		} else {
+			b.words[wordAddress] = b.words[wordAddress]&0xFF00 | uint16(value)
+			b.written[wordAddress] |= lowByte
+		}
+	}
+	return nil
+}
+
+// segments returns the words collected so far as sorted segments.
+// Every word must have been completely written.
+func (b *wordBuilder) segments() ([]Segment, error) {
+	var addresses []uint32
+	for address := range b.words {
+		if b.written[address] != highByte|lowByte {
+			return nil, fmt.Errorf("only one byte of word %05X is given", address)
+		}
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+
+	var segments []Segment
+	for _, address := range addresses {
+		n := len(segments)
+		if n > 0 && segments[n-1].Address+uint32(len(segments[n-1].Words)) == address {
+			segments[n-1].Words = append(segments[n-1].Words, b.words[address])
+			continue
+		}
+		segments = append(segments, Segment{Address: address, Words: []uint16{b.words[address]}})
+	}
+	return segments, nil
+}
+
+// wordAddress converts an address in the file to a word address
+func (a Addressing) wordAddress(address uint32) uint32 {
+	if a == ByteAddressing {
+		return address / 2
+	}
+	return address
+}
+
+// Inspect prints the segments and start address
+func (f *WordImage) Inspect(w io.Writer) {
+	fmt.Fprintf(w, "Format        [%s, %s addressing]\n", f.Format, f.Addressing)
+	for _, s := range f.Segments {
+		fmt.Fprintf(w, "Segment       [%05X-%05X] %d words\n", s.Address, s.Address+uint32(len(s.Words))-1, len(s.Words))
+	}
+	if f.HasStartAddress {
+		fmt.Fprintf(w, "Start Address [%05X]\n", f.StartAddress)
+	}
+}
+
+// LoadInto writes the segments and, if the file gave one, sets
+// the PC to the start address.  Loaders do not set CS so the
+// start address must be in the first 64K words.
+// Nothing is written unless every segment fits in writable memory.
+func (f *WordImage) LoadInto(m Machine) error {
+	if f.HasStartAddress && f.StartAddress > 0xFFFF {
+		return fmt.Errorf("start address %05X is beyond FFFF", f.StartAddress)
+	}
+	for _, s := range f.Segments {
+		if err := m.CheckWritable(s.Address, uint32(len(s.Words))); err != nil {
+			return err
+		}
+	}
+	for _, s := range f.Segments {
+		for i, w := range s.Words {
+			m.Write(s.Address+uint32(i), w)
+		}
+	}
+	if f.HasStartAddress {
+		m.SetPC(uint16(f.StartAddress))
+	}
+	return nil
+}
+
+// readWords reads length words from start with read
+func readWords(read func(address uint32) uint16, start uint32, length uint32) ([]uint16, error) {
+	if length == 0 || start > MaxWordAddress || length-1 > MaxWordAddress-start {
+		return nil, fmt.Errorf("range %05X length %X is not within 00000-%05X", start, length, MaxWordAddress)
+	}
+	words := make([]uint16, length)
+	for i := range words {
+		words[i] = read(start + uint32(i))
+	}
+	return words, nil
+}
+
+// wordsToBytes returns words as big endian bytes
+func wordsToBytes(words []uint16) []byte {
+	data := make([]byte, 2*len(words))
+	for i, w := range words {
+		data[2*i] = byte(w >> 8)
+		data[2*i+1] = byte(w)
+	}
+	return data
+}
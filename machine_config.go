@@ -0,0 +1,147 @@
+package main
+
+import (
+	"albert_go_sim/blockdevice"
+	"albert_go_sim/config"
+	"albert_go_sim/counter"
+	"albert_go_sim/device"
+	"albert_go_sim/memory"
+	"albert_go_sim/rtc"
+	"albert_go_sim/serialport"
+	"albert_go_sim/timer"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// configuredDevice is a device from the machine description
+// which has been created but not yet initialized.
+// init may block e.g. waiting for a TCP client to connect.
+type configuredDevice struct {
+	spec   config.Device
+	device device.Device
+	init   func() error
+}
+
+// InitFromConfig is the non interactive alternative to Init.
+// It builds the machine from a validated description.
+func InitFromConfig(m *config.Machine) {
+	var devices []configuredDevice
+	for _, spec := range m.Devices {
+		devices = append(devices, newConfiguredDevice(spec))
+	}
+
+	// Check the interrupt wiring before anything blocks waiting for a client
+	for _, d := range devices {
+		for name := range d.spec.Interrupts {
+			if _, ok := device.FindInterrupt(d.device, name); !ok {
+				fmt.Printf("Device %s (%s) has no interrupt output %s\n", d.spec.Name, d.spec.Type, name)
+				os.Exit(1)
+			}
+		}
+	}
+
+	for _, d := range devices {
+		if err := d.init(); err != nil {
+			fmt.Printf("Could not initialize device %s: %v\n", d.spec.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	interruptController1.Init()
+	mycpu.Init()
+	// The -rom flag wins over the machine description
+	if romFile == "" {
+		romFile = m.ROM.File
+		romFormat = m.ROM.Format
+	}
+	initROM()
+
+	// Devices tick in the order they are described; the
+	// interrupt controller ticks after all of its sources.
+	mem.AddDevice(memory.RomCS, &rom1)
+	mem.AddDevice(memory.RAMCS, &ram1)
+	for _, d := range devices {
+		if d.spec.ChipSelect == "" {
+			mem.Registry.Register(d.device)
+			continue
+		}
+		chipSelect, _ := config.ParseChipSelect(d.spec.ChipSelect)
+		mem.AddDevice(chipSelect, d.device)
+	}
+	chipSelect, _ := config.ParseChipSelect(m.InterruptController.ChipSelect)
+	mem.AddDevice(chipSelect, &interruptController1)
+
+	for _, d := range devices {
+		var names []string
+		for name := range d.spec.Interrupts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			line := d.spec.Interrupts[name]
+			callback, _ := device.FindInterrupt(d.device, name)
+			interruptController1.Callbacks[line] = callback
+			fmt.Printf("Interrupt %2d is %s %s\n", line, d.spec.Name, name)
+		}
+	}
+
+	clock1.Frequency = m.Clock.Frequency
+	clock1.DoPrint = m.Clock.Print
+
+	connectCPU()
+	watchKeyboardInterrupt()
+}
+
+// newConfiguredDevice creates the device described by spec
+func newConfiguredDevice(spec config.Device) configuredDevice {
+	d := configuredDevice{spec: spec}
+
+	switch spec.Type {
+	case config.SerialType:
+		s := &serialport.SerialPort{UseTelnet: spec.Telnet, ObserverPort: spec.ObserverPort}
+		d.device = s
+		d.init = func() error {
+			s.Init(spec.Name, spec.TCPPort)
+			return nil
+		}
+
+	case config.CounterType:
+		c := &counter.Counter{}
+		d.device = c
+		d.init = func() error {
+			c.Init()
+			return nil
+		}
+
+	case config.TimerType:
+		t := &timer.Timer{}
+		d.device = t
+		d.init = func() error {
+			t.Init()
+			return nil
+		}
+
+	case config.RTCType:
+		r := &rtc.RTC{}
+		d.device = r
+		d.init = func() error {
+			r.Init()
+			if spec.SimulatedStart != "" {
+				start, _ := time.Parse(time.RFC3339, spec.SimulatedStart)
+				return r.UseSimulatedTime(start, spec.TicksPerSecond)
+			}
+			return nil
+		}
+
+	case config.BlockDeviceType:
+		b := &blockdevice.BlockDevice{ReadMemory: mem.Read, WriteMemory: mem.Write}
+		d.device = b
+		d.init = func() error {
+			return b.Init(spec.Image, spec.ReadOnly)
+		}
+	}
+
+	return d
+}
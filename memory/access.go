@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Kinds of memory access
+const (
+	AccessRead  = "R"
+	AccessWrite = "W"
+	AccessCode  = "C"
+)
+
+// AccessFilter selects which accesses are traced.  An empty
+// ChipSelects means every device; Low and High bound the address.
+type AccessFilter struct {
+	ChipSelects map[int]bool
+	Low         uint32
+	High        uint32
+}
+
+// accessTrace is the state of memory access tracing
+type accessTrace struct {
+	w      io.Writer
+	filter AccessFilter
+}
+
+// ParseAccessFilter builds a filter from a list of devices and an
+// address range, either of which may be empty to mean all.
+// Devices are chip selects (F000 ... F0D0, RAM, ROM) or device names
+// e.g. "F010 Console".  The range is hex e.g. F000-F0DF.
+func (m *TMemory) ParseAccessFilter(devices string, addressRange string) (AccessFilter, error) {
+	filter := AccessFilter{Low: 0, High: MEMSIZE - 1}
+
+	for _, name := range strings.Fields(devices) {
+		if filter.ChipSelects == nil {
+			filter.ChipSelects = make(map[int]bool)
+		}
+		chipSelect, ok := m.findChipSelect(name)
+		if !ok {
+			return filter, fmt.Errorf("no device or chip select %s", name)
+		}
+		filter.ChipSelects[chipSelect] = true
+	}
+
+	if addressRange != "" {
+		parts := strings.SplitN(addressRange, "-", 2)
+		low, err := strconv.ParseUint(parts[0], 16, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid address range %s", addressRange)
+		}
+		high := low
+		if len(parts) == 2 {
+			if high, err = strconv.ParseUint(parts[1], 16, 32); err != nil {
+				return filter, fmt.Errorf("invalid address range %s", addressRange)
+			}
+		}
+		filter.Low, filter.High = uint32(low), uint32(high)
+	}
+	return filter, nil
+}
+
+// findChipSelect returns the chip select called name or
+// the chip select of the device called name
+func (m *TMemory) findChipSelect(name string) (int, bool) {
+	for chipSelect := range m.mappedDevice {
+		if strings.EqualFold(name, chipSelectName(chipSelect)) {
+			return chipSelect, true
+		}
+		d := m.mappedDevice[chipSelect]
+		if d.isMapped && strings.EqualFold(name, d.device.Name()) {
+			return chipSelect, true
+		}
+	}
+	return 0, false
+}
+
+// chipSelectName returns e.g. F010, RAM or ROM
+func chipSelectName(chipSelect int) string {
+	switch chipSelect {
+	case RAMCS:
+		return "RAM"
+	case RomCS:
+		return "ROM"
+	}
+	return fmt.Sprintf("F0%X0", chipSelect)
+}
+
+// StartAccessTrace logs every read, write and code read selected
+// by filter to w until StopAccessTrace is called
+func (m *TMemory) StartAccessTrace(w io.Writer, filter AccessFilter) {
+	m.accessTrace = accessTrace{w: w, filter: filter}
+}
+
+// StopAccessTrace stops logging memory accesses
+func (m *TMemory) StopAccessTrace() {
+	m.accessTrace = accessTrace{}
+}
+
+// IsAccessTracing is true between StartAccessTrace and StopAccessTrace
+func (m *TMemory) IsAccessTracing() bool {
+	return m.accessTrace.w != nil
+}
+
+// traceAccess logs one access if it passes the filter
+func (m *TMemory) traceAccess(kind string, address uint32, index int, value uint16) {
+	filter := &m.accessTrace.filter
+	if address < filter.Low || address > filter.High {
+		return
+	}
+	if filter.ChipSelects != nil && !filter.ChipSelects[index] {
+		return
+	}
+	pc := uint32(0)
+	if m.InstructionAddress != nil {
+		pc = m.InstructionAddress()
+	}
+	fmt.Fprintf(m.accessTrace.w, "PC:%05X %s %05X %04X %-4s %s\n",
+		pc, kind, address, value, chipSelectName(index), m.mappedDevice[index].device.Name())
+}
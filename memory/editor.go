@@ -0,0 +1,460 @@
+package memory
+
+import (
+	"albert_go_sim/cli"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// wordsPerDumpLine is the number of words on each line of a dump
+const wordsPerDumpLine = 8
+
+// maxSearchMatches limits the number of matches a search prints
+const maxSearchMatches = 64
+
+// ParseAddress takes a hex address which is either a 20 bit linear
+// address e.g. "F0010" or segment:offset e.g. "F000:0010"
+func ParseAddress(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	var address uint64
+	if segment, offset, ok := strings.Cut(s, ":"); ok {
+		seg, err := strconv.ParseUint(segment, 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid segment in %q", s)
+		}
+		off, err := strconv.ParseUint(offset, 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset in %q", s)
+		}
+		address = seg<<4 + off
+	} else {
+		n, err := strconv.ParseUint(s, 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid address %q", s)
+		}
+		address = n
+	}
+	if address > MEMSIZE-1 {
+		return 0, fmt.Errorf("address %s is past the end of memory", s)
+	}
+	return uint32(address), nil
+}
+
+// parseCount takes a hex number of words.  Blank means defaultCount.
+func parseCount(s string, defaultCount uint32) (uint32, error) {
+	if strings.TrimSpace(s) == "" {
+		return defaultCount, nil
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 16, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid number of words %q", s)
+	}
+	return uint32(n), nil
+}
+
+// parseWords takes hex words separated by spaces e.g. "0048 0065"
+func parseWords(s string) ([]uint16, error) {
+	var words []uint16
+	for _, field := range strings.Fields(s) {
+		n, err := strconv.ParseUint(field, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid word %q", field)
+		}
+		words = append(words, uint16(n))
+	}
+	return words, nil
+}
+
+// checkRange makes sure count words from start fit in memory
+func checkRange(start uint32, count uint32) error {
+	if uint64(start)+uint64(count) > MEMSIZE {
+		return fmt.Errorf("%X words from %05X runs past the end of memory", count, start)
+	}
+	return nil
+}
+
+// isMapped reports whether address is backed by RAM, ROM or a device
+func (m *TMemory) isMapped(address uint32) bool {
+	index, _ := _helper(address)
+	return m.mappedDevice[index].isMapped
+}
+
+// isDevice reports whether address is a memory mapped device register.
+// Reading one may have side effects e.g. taking a character.
+func isDevice(address uint32) bool {
+	index, _ := _helper(address)
+	return index != RAMCS && index != RomCS
+}
+
+// CheckMemoryRange makes sure count words from start are all RAM
+// or ROM, so they can be read without disturbing any device
+func (m *TMemory) CheckMemoryRange(start uint32, count uint32) error {
+	if err := checkRange(start, count); err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		if isDevice(start + i) {
+			return fmt.Errorf("address %05X is a device register", start+i)
+		}
+		if !m.isMapped(start + i) {
+			return fmt.Errorf("address %05X is not mapped", start+i)
+		}
+	}
+	return nil
+}
+
+// CheckWritableRange makes sure count words from start are all RAM,
+// so they can be written without stopping the simulator.  ROM, device
+// registers and unmapped memory are refused.
+func (m *TMemory) CheckWritableRange(start uint32, count uint32) error {
+	if err := m.CheckMemoryRange(start, count); err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		if index, _ := _helper(start + i); index == RomCS {
+			return fmt.Errorf("address %05X is ROM", start+i)
+		}
+	}
+	return nil
+}
+
+// printable returns value as a character for the side panel of a dump
+func printable(value uint16) byte {
+	if value >= 32 && value <= 126 {
+		return byte(value)
+	}
+	return '.'
+}
+
+// DumpRange writes count words from start to w, eight to a line
+// with the words shown as characters on the right.
+// Unmapped addresses are shown as ---- and device registers, which
+// are not read, as dev.
+func (m *TMemory) DumpRange(w io.Writer, start uint32, count uint32) error {
+	if err := checkRange(start, count); err != nil {
+		return err
+	}
+	for line := uint32(0); line < count; line += wordsPerDumpLine {
+		var hex strings.Builder
+		var text strings.Builder
+		for i := line; i < line+wordsPerDumpLine; i++ {
+			address := start + i
+			switch {
+			case i >= count:
+				hex.WriteString("     ")
+			case !m.isMapped(address):
+				hex.WriteString(" ----")
+				text.WriteByte(' ')
+			case isDevice(address):
+				hex.WriteString(" dev ")
+				text.WriteByte(' ')
+			default:
+				value := m.Peek(address)
+				fmt.Fprintf(&hex, " %04X", value)
+				text.WriteByte(printable(value))
+			}
+		}
+		fmt.Fprintf(w, "  %05X:%s  |%s|\n", start+line, hex.String(), text.String())
+	}
+	return nil
+}
+
+// Fill writes value to count words from start, which must be RAM
+func (m *TMemory) Fill(start uint32, count uint32, value uint16) error {
+	if err := m.CheckWritableRange(start, count); err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		m.Write(start+i, value)
+	}
+	return nil
+}
+
+// Copy copies count words from source to destination.
+// The ranges may overlap.  The source must be RAM or ROM
+// and the destination RAM.
+func (m *TMemory) Copy(source uint32, destination uint32, count uint32) error {
+	if err := m.CheckMemoryRange(source, count); err != nil {
+		return err
+	}
+	if err := m.CheckWritableRange(destination, count); err != nil {
+		return err
+	}
+	if destination > source {
+		for i := count; i > 0; i-- {
+			m.Write(destination+i-1, m.Peek(source+i-1))
+		}
+		return nil
+	}
+	for i := uint32(0); i < count; i++ {
+		m.Write(destination+i, m.Peek(source+i))
+	}
+	return nil
+}
+
+// Search returns the addresses in count words from start where
+// pattern occurs.  Device registers are skipped.
+func (m *TMemory) Search(pattern []uint16, start uint32, count uint32) ([]uint32, error) {
+	if err := checkRange(start, count); err != nil {
+		return nil, err
+	}
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("nothing to search for")
+	}
+
+	var matches []uint32
+	end := uint64(start) + uint64(count)
+	for address := uint64(start); address+uint64(len(pattern)) <= end; address++ {
+		found := true
+		for i, want := range pattern {
+			a := uint32(address) + uint32(i)
+			if isDevice(a) || !m.isMapped(a) || m.Peek(a) != want {
+				found = false
+				break
+			}
+		}
+		if found {
+			matches = append(matches, uint32(address))
+		}
+	}
+	return matches, nil
+}
+
+// Compare returns the offsets within count words at which
+// the ranges starting at a and b differ.  Both must be RAM or ROM.
+func (m *TMemory) Compare(a uint32, b uint32, count uint32) ([]uint32, error) {
+	if err := m.CheckMemoryRange(a, count); err != nil {
+		return nil, err
+	}
+	if err := m.CheckMemoryRange(b, count); err != nil {
+		return nil, err
+	}
+	var differences []uint32
+	for i := uint32(0); i < count; i++ {
+		if m.Peek(a+i) != m.Peek(b+i) {
+			differences = append(differences, i)
+		}
+	}
+	return differences, nil
+}
+
+// UnpackedString returns s with one character per word
+func UnpackedString(s string) []uint16 {
+	words := make([]uint16, len(s))
+	for i := 0; i < len(s); i++ {
+		words[i] = uint16(s[i])
+	}
+	return words
+}
+
+// PackedString returns s with two characters per word, the first
+// in the high byte.  An odd length leaves the last low byte 0.
+func PackedString(s string) []uint16 {
+	words := make([]uint16, (len(s)+1)/2)
+	for i := 0; i < len(s); i++ {
+		if i%2 == 0 {
+			words[i/2] = uint16(s[i]) << 8
+		} else {
+			words[i/2] |= uint16(s[i])
+		}
+	}
+	return words
+}
+
+// promptAddress asks for an address
+func promptAddress(prompt string) (uint32, error) {
+	return ParseAddress(cli.RawInput(prompt + " (hex or segment:offset) >"))
+}
+
+// Dump is an interactive function which lets the user
+// specify an area of memory to dump
+func (m *TMemory) Dump() {
+	start, err := promptAddress("Enter starting address")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	count, err := parseCount(cli.RawInput("Enter number of words (in hex, blank = 10) >"), 0x10)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if err := m.DumpRange(os.Stdout, start, count); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+// Patch is an interactive function which shows one word at a time.
+// Enter hex words to write them, blank to leave a word alone
+// or . to finish.  Device registers are shown as dev rather than
+// read.  Only RAM may be written.
+func (m *TMemory) Patch() {
+	address, err := promptAddress("Enter starting address")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	for address < MEMSIZE {
+		if !m.isMapped(address) {
+			fmt.Printf("address %05X is not mapped\n", address)
+			return
+		}
+		value := "dev "
+		if !isDevice(address) {
+			value = fmt.Sprintf("%04X", m.Peek(address))
+		}
+		s := strings.TrimSpace(cli.RawInput(fmt.Sprintf("  %05X: %s >", address, value)))
+		if s == "." {
+			return
+		}
+		if s == "" {
+			address++
+			continue
+		}
+		words, err := parseWords(s)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		if err := m.CheckWritableRange(address, uint32(len(words))); err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		for _, w := range words {
+			m.Write(address, w)
+			address++
+		}
+	}
+}
+
+// FillMemory is an interactive front end to Fill
+func (m *TMemory) FillMemory() {
+	start, err := promptAddress("Enter starting address")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	count, err := parseCount(cli.RawInput("Enter number of words (in hex) >"), 0)
+	if err != nil || count == 0 {
+		fmt.Printf("invalid number of words\n")
+		return
+	}
+	value, err := strconv.ParseUint(cli.RawInput("Enter value (in hex) >"), 16, 16)
+	if err != nil {
+		fmt.Printf("invalid value\n")
+		return
+	}
+	if err := m.Fill(start, count, uint16(value)); err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	fmt.Printf("Filled %X words from %05X with %04X\n", count, start, value)
+}
+
+// CopyMemory is an interactive front end to Copy
+func (m *TMemory) CopyMemory() {
+	source, err := promptAddress("Enter source address")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	destination, err := promptAddress("Enter destination address")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	count, err := parseCount(cli.RawInput("Enter number of words (in hex) >"), 0)
+	if err != nil || count == 0 {
+		fmt.Printf("invalid number of words\n")
+		return
+	}
+	if err := m.Copy(source, destination, count); err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	fmt.Printf("Copied %X words from %05X to %05X\n", count, source, destination)
+}
+
+// SearchMemory is an interactive front end to Search.
+// A quoted string is searched for both one character per
+// word and packed two characters per word.
+func (m *TMemory) SearchMemory() {
+	s := strings.TrimSpace(cli.RawInput(`Enter hex words (e.g. 0048 0065) or a quoted string (e.g. "Hello") >`))
+	patterns := make(map[string][]uint16)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		patterns["string"] = UnpackedString(s[1 : len(s)-1])
+		patterns["packed string"] = PackedString(s[1 : len(s)-1])
+	} else {
+		words, err := parseWords(s)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		patterns["words"] = words
+	}
+
+	start := uint32(0)
+	if s := cli.RawInput("Enter starting address (hex or segment:offset, blank = 00000) >"); s != "" {
+		var err error
+		if start, err = ParseAddress(s); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+	}
+	count, err := parseCount(cli.RawInput("Enter number of words (in hex, blank = to the end of memory) >"), MEMSIZE-start)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	for _, kind := range []string{"words", "string", "packed string"} {
+		pattern, ok := patterns[kind]
+		if !ok {
+			continue
+		}
+		matches, err := m.Search(pattern, start, count)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		fmt.Printf("Found %s %d times\n", kind, len(matches))
+		for i, address := range matches {
+			if i == maxSearchMatches {
+				fmt.Printf("  ...\n")
+				break
+			}
+			fmt.Printf("  %05X (%04X:%04X)\n", address, address>>4, address&0xF)
+		}
+	}
+}
+
+// CompareMemory is an interactive front end to Compare
+func (m *TMemory) CompareMemory() {
+	a, err := promptAddress("Enter first address")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	b, err := promptAddress("Enter second address")
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	count, err := parseCount(cli.RawInput("Enter number of words (in hex) >"), 0)
+	if err != nil || count == 0 {
+		fmt.Printf("invalid number of words\n")
+		return
+	}
+	differences, err := m.Compare(a, b, count)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	for _, i := range differences {
+		fmt.Printf("  %05X: %04X  %05X: %04X\n", a+i, m.Peek(a+i), b+i, m.Peek(b+i))
+	}
+	fmt.Printf("%d of %X words differ\n", len(differences), count)
+}
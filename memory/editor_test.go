@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"albert_go_sim/ram"
+	"albert_go_sim/rom"
+	"strings"
+	"testing"
+)
+
+// newTestMemory returns memory with RAM, ROM and, standing in for a
+// device at F000-F00F, a second RAM so writes to it can be seen
+func newTestMemory() (*TMemory, *ram.RAM) {
+	var m TMemory
+	m.AddDevice(RomCS, &rom.Rom{})
+	m.AddDevice(RAMCS, &ram.RAM{})
+	device := &ram.RAM{}
+	m.AddDevice(F000, device)
+	return &m, device
+}
+
+func TestWritesOnlyReachRAM(t *testing.T) {
+	m, device := newTestMemory()
+	tests := []struct {
+		name    string
+		write   func() error
+		wantErr string
+	}{
+		{"fill ROM", func() error { return m.Fill(0x003FE, 4, 0x1234) }, "003FE is ROM"},
+		{"fill over a device", func() error { return m.Fill(0x0EFFE, 4, 0x1234) }, "0F000 is a device register"},
+		{"fill unmapped device", func() error { return m.Fill(0x0F010, 1, 0x1234) }, "0F010 is a device register"},
+		{"fill ROM in bank 1", func() error { return m.Fill(0x1FFFF, 2, 0x1234) }, "20000 is ROM"},
+		{"copy to ROM", func() error { return m.Copy(0x00400, 0x00000, 4) }, "00000 is ROM"},
+		{"copy to a device", func() error { return m.Copy(0x00400, 0x0F000, 1) }, "0F000 is a device register"},
+		{"copy past the end", func() error { return m.Copy(0x00400, 0xFFFFF, 2) }, "past the end of memory"},
+	}
+	for _, test := range tests {
+		err := test.write()
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %q does not mention %q", test.name, err, test.wantErr)
+		}
+	}
+
+	for a := uint32(0x0EFFE); a < 0x0F000; a++ {
+		if m.Peek(a) != 0 {
+			t.Errorf("RAM at %05X was written before an error", a)
+		}
+	}
+	if device[0] != 0 {
+		t.Errorf("device register was written")
+	}
+}
+
+func TestFillAndCopyRAM(t *testing.T) {
+	m, _ := newTestMemory()
+	if err := m.Fill(0x00400, 4, 0xABCD); err != nil {
+		t.Fatal(err)
+	}
+	// Copy from ROM, which may be read
+	if err := m.Copy(0x00000, 0x00402, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{0xABCD, 0xABCD, 0, 0}
+	for i, w := range want {
+		if got := m.Peek(0x00400 + uint32(i)); got != w {
+			t.Errorf("%05X is %04X; want %04X", 0x00400+i, got, w)
+		}
+	}
+}
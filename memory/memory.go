@@ -1,11 +1,10 @@
 package memory
 
 import (
-	"albert_go_sim/cli"
+	"albert_go_sim/device"
 	"fmt"
 	"os"
 	"runtime"
-	"strconv"
 )
 
 // Constants associated with memory mapped devices.
@@ -51,14 +50,20 @@ const (
 // RAM with protection plus an array of mapped devices
 type TMemory struct {
 	mappedDevice [16]struct {
-		readData  func(address uint32) uint16
-		writeData func(address uint32, value uint16)
-		isMapped  bool
+		device   device.Device
+		isMapped bool
 	}
-	memory [MEMSIZE]struct {
+	// Registry holds every device in the machine, mapped or not.
+	// AddDevice registers the devices it maps.
+	Registry device.Registry
+	memory   [MEMSIZE]struct {
 		data       uint16
 		protection uint8
 	}
+	// InstructionAddress (optional) returns the address of the
+	// instruction being executed for the memory access trace
+	InstructionAddress func() uint32
+	accessTrace        accessTrace
 }
 
 // _helper takes the address of a memory mapped device
@@ -116,8 +121,21 @@ func (m *TMemory) Read(address uint32) uint16 {
 		runtime.Goexit()
 	}
 
-	value := m.mappedDevice[index].readData(subAddress)
+	value := m.mappedDevice[index].device.Read(subAddress)
+	if m.accessTrace.w != nil {
+		m.traceAccess(AccessRead, address, index, value)
+	}
+
+	return value
+}
 
+// Peek is Read without the memory access trace.  It is for the
+// simulator's own use e.g. snapshots for the history.
+func (m *TMemory) Peek(address uint32) uint16 {
+	w := m.accessTrace.w
+	m.accessTrace.w = nil
+	value := m.Read(address)
+	m.accessTrace.w = w
 	return value
 }
 
@@ -138,7 +156,10 @@ func (m *TMemory) ReadCodeMemory(address uint32) uint16 {
 		runtime.Goexit()
 	}
 
-	value := m.mappedDevice[index].readData(subAddress)
+	value := m.mappedDevice[index].device.Read(subAddress)
+	if m.accessTrace.w != nil {
+		m.traceAccess(AccessCode, address, index, value)
+	}
 
 	return value
 }
@@ -160,23 +181,25 @@ func (m *TMemory) Write(address uint32, value uint16) {
 		runtime.Goexit()
 	}
 
-	m.mappedDevice[index].writeData(subAddress, value)
+	m.mappedDevice[index].device.Write(subAddress, value)
+	if m.accessTrace.w != nil {
+		m.traceAccess(AccessWrite, address, index, value)
+	}
 }
 
 // AddDevice maps a device based on an addresRange
-func (m *TMemory) AddDevice(addressRange int,
-	read func(address uint32) uint16,
-	write func(address uint32, value uint16)) {
+// and adds it to the Registry
+func (m *TMemory) AddDevice(addressRange int, d device.Device) {
 
 	if m.mappedDevice[addressRange].isMapped {
 		fmt.Printf("Tried to add device to existing mem map location!")
 		os.Exit(1)
 	}
-	fmt.Printf("Added device with CS %d\n", addressRange)
+	fmt.Printf("Added device %s with CS %d\n", d.Name(), addressRange)
 
-	m.mappedDevice[addressRange].readData = read
-	m.mappedDevice[addressRange].writeData = write
+	m.mappedDevice[addressRange].device = d
 	m.mappedDevice[addressRange].isMapped = true
+	m.Registry.Register(d)
 }
 
 // dump is an interactive function which lets the user
@@ -202,88 +225,7 @@ func (m *TMemory) AddDevice(addressRange int,
 // 	}
 // }
 
-// load403File - uses Original Pat loader format from 2006!
-// It is interactive and prompts for a file name.
-// TODO create a return value to show success or failure
-// func load403File() {
-
-// 	// read4 returns uint16 by reading 4 HEX digits from f
-// 	read4 := func(f *os.File) uint16 {
-// 		b := make([]byte, 4)
-// 		f.Read(b)
-// 		s := string(b)
-// 		n, _ := strconv.ParseUint(s, 16, 32)
-// 		w := uint16(n)
-// 		return (w)
-
-// 	}
-
-// 	filename := cli.RawInput("Enter 403 file name >")
-// 	fileInfo, err := os.Stat(filename)
-// 	if err != nil {
-// 		fmt.Printf("Could not stat file [%s].  Returning\n", filename)
-// 		return
-// 	}
-// 	actualFileSize := fileInfo.Size()
-// 	fmt.Printf("File Size is %d\n", actualFileSize)
-// 	if actualFileSize < 12 {
-// 		fmt.Printf("File is too small to be a valid 403 file; returning...\n")
-// 		return
-// 	}
-
-// 	f, err := os.Open(filename)
-// 	if err != nil {
-// 		fmt.Printf("Could not open %s\n", filename)
-// 		return
-// 	}
-
-// 	objectLength := read4(f)
-// 	requiredFileSize := 4 + 4 + 4*objectLength
-// 	if actualFileSize != int64(requiredFileSize) {
-// 		fmt.Printf("file size mismatch; returning...\n")
-// 	}
-// 	startAddress := read4(f)
-
-// 	fmt.Printf("Setting PC to [%04X]\n", startAddress)
-// 	mycpu.SetPC(startAddress)
-
-// 	memoryAddress := uint32(0x0403)
-// 	for {
-// 		if objectLength == 0 {
-// 			break
-// 		}
-// 		dataWord := read4(f)
-// 		ram.write(memoryAddress, dataWord)
-// 		memoryAddress++
-// 		objectLength--
-// 	}
-
-// }
-
 // mycpu.ReadCodeMemory = ram.read
 // mycpu.ReadDataMemory = ram.read
 // mycpu.WriteDataMemory = ram.write
 // mycpu.InterruptCallback = interruptController1.GetOutput
-
-// Dump is an interactive function which lets the user
-// specify an area of memory to dump
-func (m *TMemory) Dump() {
-	s := cli.RawInput("Enter starting address (in hex) >")
-
-	n, _ := strconv.ParseUint(s, 16, 32)
-	startingAddress := uint32(n)
-
-	size := uint32(16)
-
-	for i := uint32(0); i < size; i++ {
-		var s string
-		workingAddress := startingAddress + i
-		value := m.Read(workingAddress)
-		if value >= 32 && value <= 126 {
-			s = fmt.Sprintf("%s", string(value))
-		} else {
-			s = "NP"
-		}
-		fmt.Printf("  %04X: %04X %3s\n", workingAddress, value, s)
-	}
-}
@@ -0,0 +1,203 @@
+package object
+
+import (
+	"albert_go_sim/v4"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Options control where the linker places the sections
+type Options struct {
+	CodeAddress uint16
+	// DataAddress is used if IsDataAddressSet; otherwise the
+	// data is placed immediately after the code
+	DataAddress      uint16
+	IsDataAddressSet bool
+	// Entry overrides the entry given in the objects
+	Entry string
+}
+
+// ModuleMap says where the linker placed one object
+type ModuleMap struct {
+	Name        string
+	CodeAddress uint16
+	CodeSize    int
+	DataAddress uint16
+	DataSize    int
+}
+
+// SymbolMap says where the linker placed one symbol
+type SymbolMap struct {
+	Name    string
+	Module  string
+	Section Section
+	Address uint16
+}
+
+// Map describes a linked image
+type Map struct {
+	Entry   uint16
+	Modules []ModuleMap
+	Symbols []SymbolMap
+}
+
+// Link places the objects one after another, resolves their
+// relocations and returns the V4 image and its map.
+// All problems are reported, not just the first.
+func Link(objects []*Object, options Options) (*v4.File, *Map, error) {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Place the sections
+	var linkMap Map
+	codeSize, dataSize := 0, 0
+	for _, o := range objects {
+		linkMap.Modules = append(linkMap.Modules, ModuleMap{
+			Name:        o.Module,
+			CodeAddress: options.CodeAddress + uint16(codeSize),
+			CodeSize:    len(o.Code),
+			DataSize:    len(o.Data),
+		})
+		codeSize += len(o.Code)
+		dataSize += len(o.Data)
+	}
+	dataAddress := int(options.CodeAddress) + codeSize
+	if options.IsDataAddressSet {
+		dataAddress = int(options.DataAddress)
+	}
+	if int(options.CodeAddress)+codeSize > 0x10000 {
+		problem("code of %04X words at %04X does not fit below 10000", codeSize, options.CodeAddress)
+	}
+	if dataAddress+dataSize > 0x10000 {
+		problem("data of %04X words at %04X does not fit below 10000", dataSize, dataAddress)
+	}
+	codeEnd := int(options.CodeAddress) + codeSize
+	if codeSize > 0 && dataSize > 0 && dataAddress < codeEnd && int(options.CodeAddress) < dataAddress+dataSize {
+		problem("data %04X-%04X overlaps code %04X-%04X", dataAddress, dataAddress+dataSize-1, options.CodeAddress, codeEnd-1)
+	}
+	if len(problems) != 0 {
+		return nil, nil, errors.New(strings.Join(problems, "\n"))
+	}
+	offset := 0
+	for i := range linkMap.Modules {
+		linkMap.Modules[i].DataAddress = uint16(dataAddress + offset)
+		offset += linkMap.Modules[i].DataSize
+	}
+
+	// Collect the symbols
+	symbols := make(map[string]SymbolMap)
+	for i, o := range objects {
+		for _, s := range o.Symbols {
+			address := linkMap.Modules[i].CodeAddress + s.Offset
+			if s.Section == Data {
+				address = linkMap.Modules[i].DataAddress + s.Offset
+			}
+			if other, ok := symbols[s.Name]; ok {
+				problem("%s: symbol %s is already defined in %s", o.Module, s.Name, other.Module)
+				continue
+			}
+			symbols[s.Name] = SymbolMap{Name: s.Name, Module: o.Module, Section: s.Section, Address: address}
+		}
+	}
+
+	// Copy the sections and relocate them
+	code := make([]uint16, 0, codeSize)
+	data := make([]uint16, 0, dataSize)
+	for i, o := range objects {
+		module := linkMap.Modules[i]
+		objectCode := append([]uint16(nil), o.Code...)
+		objectData := append([]uint16(nil), o.Data...)
+		for _, r := range o.Relocations {
+			address := module.CodeAddress
+			if r.Target == Data {
+				address = module.DataAddress
+			}
+			if r.Symbol != "" {
+				s, ok := symbols[r.Symbol]
+				if !ok {
+					problem("%s: %s at %s %04X refers to undefined symbol %s", o.Module, r.Kind, r.Section, r.Offset, r.Symbol)
+					continue
+				}
+				address = s.Address
+			}
+			if r.Section == Data {
+				objectData[r.Offset] += address
+			} else {
+				objectCode[r.Offset] += address
+			}
+		}
+		code = append(code, objectCode...)
+		data = append(data, objectData...)
+	}
+
+	// Find the entry
+	entry := options.Entry
+	for _, o := range objects {
+		if entry == "" {
+			entry = o.Entry
+		} else if o.Entry != "" && options.Entry == "" && o.Entry != entry {
+			problem("%s: entry %s conflicts with entry %s", o.Module, o.Entry, entry)
+		}
+	}
+	linkMap.Entry = options.CodeAddress
+	if entry != "" {
+		s, ok := symbols[entry]
+		if !ok {
+			problem("entry %s is not defined", entry)
+		} else if s.Section != Code {
+			problem("entry %s is not in a code section", entry)
+		}
+		linkMap.Entry = s.Address
+	}
+
+	if len(problems) != 0 {
+		return nil, nil, errors.New(strings.Join(problems, "\n"))
+	}
+
+	for _, s := range symbols {
+		linkMap.Symbols = append(linkMap.Symbols, s)
+	}
+	sort.Slice(linkMap.Symbols, func(i, j int) bool {
+		a, b := linkMap.Symbols[i], linkMap.Symbols[j]
+		if a.Section != b.Section {
+			return a.Section < b.Section
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Name < b.Name
+	})
+
+	image := v4.New(code, options.CodeAddress, linkMap.Entry, data, uint16(dataAddress))
+	return image, &linkMap, nil
+}
+
+// Write prints the map
+func (m *Map) Write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Entry %04X\n\n", m.Entry)
+	fmt.Fprintf(&b, "%-20s %-9s  %-9s\n", "Module", "Code", "Data")
+	for _, module := range m.Modules {
+		fmt.Fprintf(&b, "%-20s %s  %s\n", module.Name,
+			addressRange(module.CodeAddress, module.CodeSize), addressRange(module.DataAddress, module.DataSize))
+	}
+	fmt.Fprintf(&b, "\n%-4s %-4s %-20s %s\n", "Addr", "Sect", "Symbol", "Module")
+	for _, s := range m.Symbols {
+		fmt.Fprintf(&b, "%04X %-4s %-20s %s\n", s.Address, s.Section, s.Name, s.Module)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// addressRange formats a section as first-last or "empty"
+func addressRange(address uint16, size int) string {
+	if size == 0 {
+		return fmt.Sprintf("%-9s", "empty")
+	}
+	return fmt.Sprintf("%04X-%04X", address, int(address)+size-1)
+}
@@ -0,0 +1,142 @@
+package object
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustParse parses the object file text or fails the test
+func mustParse(t *testing.T, text string) *Object {
+	t.Helper()
+	o, err := Parse([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+const testMain = `
+module main
+code 000A 0000 0002 0000   ; jsr bar, dolit main's data
+data 0005 0003
+define start code 0
+ref code 1 jsr bar
+reloc code 3 dolit data
+reloc data 1 word code     ; address of code word 3
+entry start
+`
+
+const testBar = `
+module bar
+code 0001 0002
+data 0007
+define bar code 1
+define barData data 0
+`
+
+func TestLinkRelocates(t *testing.T) {
+	objects := []*Object{mustParse(t, testMain), mustParse(t, testBar)}
+	image, linkMap, err := Link(objects, Options{CodeAddress: 0x0100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// main code 0100-0103, bar code 0104-0105,
+	// main data 0106-0107, bar data 0108
+	wantCode := []uint16{0x000A, 0x0105, 0x0002, 0x0106, 0x0001, 0x0002}
+	wantData := []uint16{0x0005, 0x0103, 0x0007}
+	if !reflect.DeepEqual(image.Code, wantCode) {
+		t.Errorf("code is %04X; want %04X", image.Code, wantCode)
+	}
+	if !reflect.DeepEqual(image.Data, wantData) {
+		t.Errorf("data is %04X; want %04X", image.Data, wantData)
+	}
+	if image.CodeLoadAddress != 0x0100 || image.DataLoadAddress != 0x0106 || image.CodeStartAddress != 0x0100 {
+		t.Errorf("header is %+v", image.Header)
+	}
+	if linkMap.Modules[1].CodeAddress != 0x0104 || linkMap.Modules[1].DataAddress != 0x0108 {
+		t.Errorf("bar placed at %+v", linkMap.Modules[1])
+	}
+}
+
+func TestLinkRelocatesToDataAddress(t *testing.T) {
+	objects := []*Object{mustParse(t, testMain), mustParse(t, testBar)}
+	image, _, err := Link(objects, Options{CodeAddress: 0x0100, DataAddress: 0x2000, IsDataAddressSet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Code[3] != 0x2000 {
+		t.Errorf("dolit operand is %04X; want 2000", image.Code[3])
+	}
+	if image.DataLoadAddress != 0x2000 {
+		t.Errorf("data loaded at %04X; want 2000", image.DataLoadAddress)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []string
+		options Options
+		wantErr string
+	}{
+		{
+			name:    "undefined symbol",
+			objects: []string{testMain},
+			options: Options{CodeAddress: 0x0100},
+			wantErr: "main: jsr at code 0001 refers to undefined symbol bar",
+		},
+		{
+			name:    "duplicate symbol",
+			objects: []string{testMain, testBar, "module other\ncode 0000\ndefine bar code 0\n"},
+			options: Options{CodeAddress: 0x0100},
+			wantErr: "other: symbol bar is already defined in bar",
+		},
+		{
+			name:    "data overlaps code",
+			objects: []string{testMain, testBar},
+			options: Options{CodeAddress: 0x0100, DataAddress: 0x0104, IsDataAddressSet: true},
+			wantErr: "data 0104-0106 overlaps code 0100-0105",
+		},
+		{
+			name:    "data ends inside code",
+			objects: []string{testMain, testBar},
+			options: Options{CodeAddress: 0x0100, DataAddress: 0x00FE, IsDataAddressSet: true},
+			wantErr: "data 00FE-0100 overlaps code 0100-0105",
+		},
+		{
+			name:    "code past FFFF",
+			objects: []string{testMain, testBar},
+			options: Options{CodeAddress: 0xFFFE},
+			wantErr: "does not fit below 10000",
+		},
+		{
+			name:    "undefined entry",
+			objects: []string{testBar},
+			options: Options{CodeAddress: 0x0100, Entry: "start"},
+			wantErr: "entry start is not defined",
+		},
+	}
+	for _, test := range tests {
+		var objects []*Object
+		for _, text := range test.objects {
+			objects = append(objects, mustParse(t, text))
+		}
+		_, _, err := Link(objects, test.options)
+		if err == nil {
+			t.Errorf("%s: linked without error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %q does not mention %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestLinkAllowsAdjacentData(t *testing.T) {
+	objects := []*Object{mustParse(t, testMain), mustParse(t, testBar)}
+	if _, _, err := Link(objects, Options{CodeAddress: 0x0100, DataAddress: 0x00FD, IsDataAddressSet: true}); err != nil {
+		t.Errorf("data ending just below the code was rejected: %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+// Package object reads and writes relocatable albert object files
+// and links them into V4 images.
+//
+// An object file is text, one directive per line.  Numbers are hex
+// and ';' starts a comment.
+//
+//	module NAME
+//	code W W W ...                   append words to the code section
+//	data W W W ...                   append words to the data section
+//	define NAME SECTION OFFSET       NAME is at OFFSET in SECTION
+//	reloc SECTION OFFSET KIND TARGET word += address of TARGET section
+//	ref SECTION OFFSET KIND NAME     word += address of symbol NAME
+//	entry NAME                       execution starts at NAME
+//
+// SECTION and TARGET are code or data.  KIND says what the word is:
+// the operand of a jsr, bra, jmpf or dolit instruction, or just a word.
+// For the instruction kinds the word before it must be that opcode.
+package object
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Section is the code or the data section
+type Section int
+
+// Sections
+const (
+	Code Section = iota
+	Data
+)
+
+// String returns "code" or "data"
+func (s Section) String() string {
+	if s == Data {
+		return "data"
+	}
+	return "code"
+}
+
+// parseSection turns "code" or "data" into a Section
+func parseSection(s string) (Section, error) {
+	switch s {
+	case "code":
+		return Code, nil
+	case "data":
+		return Data, nil
+	}
+	return 0, fmt.Errorf("section %q is not code or data", s)
+}
+
+// Relocation kinds
+const (
+	KindJSR   = "jsr"
+	KindBRA   = "bra"
+	KindJMPF  = "jmpf"
+	KindDoLit = "dolit"
+	KindWord  = "word"
+)
+
+// kindOpcodes holds the opcode expected before the operand of
+// each instruction kind.  These must match the cpu package.
+var kindOpcodes = map[string]uint16{
+	KindDoLit: 2,
+	KindBRA:   4,
+	KindJSR:   10,
+	KindJMPF:  12,
+}
+
+// Symbol is a name defined by an object
+type Symbol struct {
+	Name    string
+	Section Section
+	Offset  uint16
+}
+
+// Relocation says a word must be adjusted when the object is placed.
+// If Symbol is empty the address of the Target section of this
+// object is added to the word; otherwise the address of Symbol is.
+type Relocation struct {
+	Section Section
+	Offset  uint16
+	Kind    string
+	Target  Section
+	Symbol  string
+}
+
+// Object is one relocatable object file
+type Object struct {
+	Module      string
+	Code        []uint16
+	Data        []uint16
+	Symbols     []Symbol
+	Relocations []Relocation
+	Entry       string
+}
+
+// section returns the words of section s
+func (o *Object) section(s Section) []uint16 {
+	if s == Data {
+		return o.Data
+	}
+	return o.Code
+}
+
+// Parse decodes an object file
+func Parse(data []byte) (*Object, error) {
+	var o Object
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := o.parseDirective(fields); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// parseDirective handles one line of an object file
+func (o *Object) parseDirective(fields []string) error {
+	word := func(s string) (uint16, error) {
+		n, err := strconv.ParseUint(s, 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a 16 bit hex number", s)
+		}
+		return uint16(n), nil
+	}
+	wantFields := func(n int) error {
+		if len(fields) != n {
+			return fmt.Errorf("%s needs %d fields", fields[0], n-1)
+		}
+		return nil
+	}
+
+	switch fields[0] {
+	case "module":
+		if err := wantFields(2); err != nil {
+			return err
+		}
+		o.Module = fields[1]
+
+	case "code", "data":
+		for _, s := range fields[1:] {
+			w, err := word(s)
+			if err != nil {
+				return err
+			}
+			if fields[0] == "code" {
+				o.Code = append(o.Code, w)
+			} else {
+				o.Data = append(o.Data, w)
+			}
+		}
+
+	case "define":
+		if err := wantFields(4); err != nil {
+			return err
+		}
+		section, err := parseSection(fields[2])
+		if err != nil {
+			return err
+		}
+		offset, err := word(fields[3])
+		if err != nil {
+			return err
+		}
+		o.Symbols = append(o.Symbols, Symbol{Name: fields[1], Section: section, Offset: offset})
+
+	case "reloc", "ref":
+		if err := wantFields(5); err != nil {
+			return err
+		}
+		section, err := parseSection(fields[1])
+		if err != nil {
+			return err
+		}
+		offset, err := word(fields[2])
+		if err != nil {
+			return err
+		}
+		r := Relocation{Section: section, Offset: offset, Kind: fields[3]}
+		if fields[0] == "reloc" {
+			if r.Target, err = parseSection(fields[4]); err != nil {
+				return err
+			}
+		} else {
+			r.Symbol = fields[4]
+		}
+		o.Relocations = append(o.Relocations, r)
+
+	case "entry":
+		if err := wantFields(2); err != nil {
+			return err
+		}
+		o.Entry = fields[1]
+
+	default:
+		return fmt.Errorf("unknown directive %q", fields[0])
+	}
+	return nil
+}
+
+// ReadFile reads and parses the object file fileName
+func ReadFile(fileName string) (*Object, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	o, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	if o.Module == "" {
+		o.Module = fileName
+	}
+	return o, nil
+}
+
+// Validate checks symbols and relocations lie within their sections
+// and that instruction operands follow the right opcode
+func (o *Object) Validate() error {
+	names := make(map[string]bool)
+	for _, s := range o.Symbols {
+		if names[s.Name] {
+			return fmt.Errorf("symbol %s is defined more than once", s.Name)
+		}
+		names[s.Name] = true
+		// A symbol may be at the end of its section e.g. an empty word
+		if int(s.Offset) > len(o.section(s.Section)) {
+			return fmt.Errorf("symbol %s offset %04X is past the end of the %s section", s.Name, s.Offset, s.Section)
+		}
+	}
+
+	for _, r := range o.Relocations {
+		words := o.section(r.Section)
+		if int(r.Offset) >= len(words) {
+			return fmt.Errorf("relocation at %s %04X is past the end of the section", r.Section, r.Offset)
+		}
+		if r.Kind == KindWord {
+			continue
+		}
+		opcode, ok := kindOpcodes[r.Kind]
+		if !ok {
+			return fmt.Errorf("relocation at %s %04X has unknown kind %q", r.Section, r.Offset, r.Kind)
+		}
+		if r.Section != Code || r.Offset == 0 || words[r.Offset-1] != opcode {
+			return fmt.Errorf("relocation at %s %04X is not the operand of a %s instruction", r.Section, r.Offset, r.Kind)
+		}
+	}
+
+	if o.Entry != "" && !names[o.Entry] {
+		return fmt.Errorf("entry %s is not defined", o.Entry)
+	}
+	return nil
+}
+
+// Write encodes the object
+func (o *Object) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	if o.Module != "" {
+		fmt.Fprintf(b, "module %s\n", o.Module)
+	}
+	writeWords := func(directive string, words []uint16) {
+		for i := 0; i < len(words); i += 8 {
+			fmt.Fprintf(b, "%s", directive)
+			for j := i; j < i+8 && j < len(words); j++ {
+				fmt.Fprintf(b, " %04X", words[j])
+			}
+			fmt.Fprintf(b, "\n")
+		}
+	}
+	writeWords("code", o.Code)
+	writeWords("data", o.Data)
+	for _, s := range o.Symbols {
+		fmt.Fprintf(b, "define %s %s %04X\n", s.Name, s.Section, s.Offset)
+	}
+	for _, r := range o.Relocations {
+		if r.Symbol == "" {
+			fmt.Fprintf(b, "reloc %s %04X %s %s\n", r.Section, r.Offset, r.Kind, r.Target)
+		} else {
+			fmt.Fprintf(b, "ref %s %04X %s %s\n", r.Section, r.Offset, r.Kind, r.Symbol)
+		}
+	}
+	if o.Entry != "" {
+		fmt.Fprintf(b, "entry %s\n", o.Entry)
+	}
+	return b.Flush()
+}
+
+// WriteFile encodes the object to fileName
+func (o *Object) WriteFile(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := o.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
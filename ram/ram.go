@@ -1,5 +1,7 @@
 package ram
 
+import "albert_go_sim/device"
+
 // RAMSIZE defines only the amount of RAM
 const (
 	RAMSIZE = 1 * 1024 * 1024
@@ -24,3 +26,22 @@ func (r *RAM) Clear() {
 		r[i] = 0
 	}
 }
+
+// Name returns the name of the device
+func (r *RAM) Name() string {
+	return "RAM"
+}
+
+// Tick does nothing; RAM has no time dependent behavior
+func (r *RAM) Tick() {
+}
+
+// Reset clears RAM
+func (r *RAM) Reset() {
+	r.Clear()
+}
+
+// Interrupts returns nil; RAM has no interrupt outputs
+func (r *RAM) Interrupts() []device.Interrupt {
+	return nil
+}
@@ -0,0 +1,116 @@
+package rom
+
+import (
+	"albert_go_sim/v4"
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ROM image formats
+const (
+	// HexFormat is one word per line as 4 hex digits (Pat's loader format)
+	HexFormat = "hex"
+	// BinaryFormat is raw big endian 16 bit words
+	BinaryFormat = "binary"
+	// V4Format is a V4 object file whose code and data fit in the ROM
+	V4Format = "v4"
+)
+
+// GuessFormat looks at the contents of a ROM image to decide its format
+func GuessFormat(data []byte) string {
+	if v4.IsV4(data) {
+		return V4Format
+	}
+	for _, b := range data {
+		isHex := (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+		if !isHex && b != '\n' && b != '\r' && b != ' ' && b != '\t' {
+			return BinaryFormat
+		}
+	}
+	return HexFormat
+}
+
+// loadImage replaces the contents of the ROM with the image in data.
+// The ROM is not changed if the image is invalid.
+// Notice we write directly to the rom; we do NOT
+// use the Write method because that is for the
+// public and writing is NOT permitted to ROM.
+func (r *Rom) loadImage(data []byte, format string) error {
+	if format == "" {
+		format = GuessFormat(data)
+	}
+
+	var image Rom
+	var err error
+	switch format {
+	case HexFormat:
+		err = image.parseHex(data)
+	case BinaryFormat:
+		err = image.parseBinary(data)
+	case V4Format:
+		err = image.parseV4(data)
+	default:
+		err = fmt.Errorf("unknown ROM image format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	*r = image
+	return nil
+}
+
+// parseHex reads one hex word per line.  Blank lines are ignored.
+func (r *Rom) parseHex(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	address := 0
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 16, 16)
+		if err != nil {
+			return fmt.Errorf("line %d: %q is not a 16 bit hex word", lineNum, s)
+		}
+		if address >= romSize {
+			return fmt.Errorf("image is larger than the %04X word ROM", romSize)
+		}
+		r[address] = uint16(n)
+		address++
+	}
+	return scanner.Err()
+}
+
+// parseBinary reads big endian words
+func (r *Rom) parseBinary(data []byte) error {
+	if len(data)%2 != 0 {
+		return fmt.Errorf("binary image has an odd number of bytes (%d)", len(data))
+	}
+	if len(data)/2 > romSize {
+		return fmt.Errorf("image of %04X words is larger than the %04X word ROM", len(data)/2, romSize)
+	}
+	for i := 0; i < len(data)/2; i++ {
+		r[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+	return nil
+}
+
+// parseV4 places the code and data of a V4 file at their load
+// addresses.  Both must lie entirely within the ROM.
+func (r *Rom) parseV4(data []byte) error {
+	f, err := v4.Parse(data)
+	if err != nil {
+		return err
+	}
+	if int(f.CodeLoadAddress)+len(f.Code) > romSize || int(f.DataLoadAddress)+len(f.Data) > romSize {
+		return fmt.Errorf("V4 code or data does not fit in the %04X word ROM", romSize)
+	}
+	copy(r[f.CodeLoadAddress:], f.Code)
+	copy(r[f.DataLoadAddress:], f.Data)
+	return nil
+}
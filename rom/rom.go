@@ -1,49 +1,47 @@
 package rom
 
 import (
-	"bufio"
+	"albert_go_sim/device"
+	_ "embed"
 	"fmt"
 	"os"
 	"runtime"
-	"strconv"
 )
 
 const romSize = 0x400
 
+// loader is Pat's original loader.  It is built into the
+// simulator so it can be run from any directory.
+//
+//go:embed loader_from_zero.txt
+var loader []byte
+
 // Rom is the type representing lower read only memory
 type Rom [romSize]uint16
 
-// loadPatsLoader takes the original hex "binary" and places it in ram
-func (r *Rom) loadPatsLoader() {
-	fmt.Printf("Entered loadPatsLoader\n")
-	f, err := os.Open("loader_from_zero.txt")
-	if err != nil {
-		fmt.Printf("Could not open loader file\n")
-		fmt.Printf("Error is %v\n", err)
-		os.Exit(1)
-		return
-	}
-	scanner := bufio.NewScanner(f)
-	address := uint32(0)
-	// Notice we write directly to r; we do NOT
-	// use the Write method because that is for the
-	// public and writing is NOT permitted to ROM.
-	for scanner.Scan() {
-		s := scanner.Text()
-		n, _ := strconv.ParseUint(s, 16, 32)
-		w := uint16(n)
-		// r.Write(address, w)
-		r[address] = w
-		address++
+// Init sets up memory including ROM settings
+// and protection.  The ROM holds the built in loader.
+func (r *Rom) Init() {
+	fmt.Printf("Loading built in loader into ROM\n")
+	// The built in loader is part of the program so if it
+	// does not load the program itself is broken
+	if err := r.loadImage(loader, HexFormat); err != nil {
+		panic(fmt.Sprintf("built in loader is corrupt: %v", err))
 	}
-	f.Close()
-
 }
 
-// Init sets up memory including ROM settings
-// and protection
-func (r *Rom) Init() {
-	r.loadPatsLoader()
+// InitFromFile is like Init but loads the ROM image from fileName.
+// format is one of HexFormat, BinaryFormat, V4Format or "" to guess.
+func (r *Rom) InitFromFile(fileName string, format string) error {
+	fmt.Printf("Loading ROM image %s\n", fileName)
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if err := r.loadImage(data, format); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	return nil
 }
 
 // Read takes address and returns a value
@@ -58,3 +56,21 @@ func (r *Rom) Write(address uint32, value uint16) {
 	runtime.Goexit()
 
 }
+
+// Name returns the name of the device
+func (r *Rom) Name() string {
+	return "ROM"
+}
+
+// Tick does nothing; ROM has no time dependent behavior
+func (r *Rom) Tick() {
+}
+
+// Reset does nothing; ROM contents survive a reset
+func (r *Rom) Reset() {
+}
+
+// Interrupts returns nil; ROM has no interrupt outputs
+func (r *Rom) Interrupts() []device.Interrupt {
+	return nil
+}
@@ -0,0 +1,187 @@
+package rtc
+
+import (
+	"albert_go_sim/device"
+	"fmt"
+	"time"
+)
+
+// Register addresses within the chip select
+// Reading the year register latches the whole date and time so the
+// other date and time registers are consistent with it.
+const (
+	yearAddress        = 0
+	monthAddress       = 1
+	dayAddress         = 2
+	hourAddress        = 3
+	minuteAddress      = 4
+	secondAddress      = 5
+	alarmHourAddress   = 6
+	alarmMinuteAddress = 7
+	alarmSecondAddress = 8
+	controlAddress     = 9
+	statusAddress      = 10
+)
+
+// ControlAlarmEnable enables the (daily) alarm
+const ControlAlarmEnable = 0x0001
+
+// StatusAlarm is set when the alarm time is reached.
+// It is sticky; write a 1 to it in the status register to clear it.
+const StatusAlarm = 0x0001
+
+// ticksPerAlarmCheck limits how often the host clock is consulted
+const ticksPerAlarmCheck = 10000
+
+const secondsPerDay = 24 * 60 * 60
+
+// RTC is a memory mapped real time clock.
+// By default it reports the host's local time.  Call UseSimulatedTime
+// to derive time from simulated ticks instead (for deterministic tests).
+type RTC struct {
+	latched        time.Time
+	alarmHour      uint16
+	alarmMinute    uint16
+	alarmSecond    uint16
+	control        uint16
+	status         uint16
+	isSimulated    bool
+	simulatedStart time.Time
+	ticksPerSecond uint64
+	numTicks       uint64
+	lastChecked    int
+}
+
+// Init the RTC
+func (r *RTC) Init() {
+	fmt.Printf("Initializing RTC\n")
+	r.lastChecked = secondOfDay(r.now())
+	r.latched = r.now()
+}
+
+// UseSimulatedTime makes the RTC start at start and advance one
+// second every ticksPerSecond ticks instead of following the host clock.
+// ticksPerSecond must not be 0.
+func (r *RTC) UseSimulatedTime(start time.Time, ticksPerSecond uint64) error {
+	if ticksPerSecond == 0 {
+		return fmt.Errorf("RTC ticks per second must not be 0")
+	}
+	r.isSimulated = true
+	r.simulatedStart = start
+	r.ticksPerSecond = ticksPerSecond
+	r.numTicks = 0
+	r.lastChecked = secondOfDay(r.now())
+	r.latched = r.now()
+	return nil
+}
+
+// Reset clears the alarm.  It does not change the time.
+func (r *RTC) Reset() {
+	r.alarmHour = 0
+	r.alarmMinute = 0
+	r.alarmSecond = 0
+	r.control = 0
+	r.status = 0
+}
+
+// now returns the current time as the RTC sees it
+func (r *RTC) now() time.Time {
+	if r.isSimulated {
+		return r.simulatedStart.Add(time.Duration(r.numTicks/r.ticksPerSecond) * time.Second)
+	}
+	return time.Now()
+}
+
+// secondOfDay returns the number of seconds since midnight
+func secondOfDay(t time.Time) int {
+	return t.Hour()*3600 + t.Minute()*60 + t.Second()
+}
+
+// Tick should be called on every tick off the virtual clock
+func (r *RTC) Tick() {
+	r.numTicks++
+	if r.numTicks%ticksPerAlarmCheck != 0 {
+		return
+	}
+
+	// Has the alarm time been passed since the last check?
+	current := secondOfDay(r.now())
+	if current == r.lastChecked {
+		return
+	}
+	alarm := int(r.alarmHour)*3600 + int(r.alarmMinute)*60 + int(r.alarmSecond)
+	elapsed := (current - r.lastChecked + secondsPerDay) % secondsPerDay
+	sinceAlarm := (current - alarm + secondsPerDay) % secondsPerDay
+	if r.control&ControlAlarmEnable != 0 && sinceAlarm < elapsed {
+		r.status |= StatusAlarm
+	}
+	r.lastChecked = current
+}
+
+// Read takes address and returns a value
+// Addresses are defined above
+func (r *RTC) Read(address uint32) uint16 {
+	switch address {
+	case yearAddress:
+		r.latched = r.now()
+		return uint16(r.latched.Year())
+	case monthAddress:
+		return uint16(r.latched.Month())
+	case dayAddress:
+		return uint16(r.latched.Day())
+	case hourAddress:
+		return uint16(r.latched.Hour())
+	case minuteAddress:
+		return uint16(r.latched.Minute())
+	case secondAddress:
+		return uint16(r.latched.Second())
+	case alarmHourAddress:
+		return r.alarmHour
+	case alarmMinuteAddress:
+		return r.alarmMinute
+	case alarmSecondAddress:
+		return r.alarmSecond
+	case controlAddress:
+		return r.control
+	case statusAddress:
+		return r.status
+	}
+	fmt.Printf("WARNING tried to read unmapped RTC address %02X\n", address)
+	return 0
+}
+
+// Write takes an address and a value
+// The date and time registers are read only.
+func (r *RTC) Write(address uint32, value uint16) {
+	switch address {
+	case alarmHourAddress:
+		r.alarmHour = value % 24
+	case alarmMinuteAddress:
+		r.alarmMinute = value % 60
+	case alarmSecondAddress:
+		r.alarmSecond = value % 60
+	case controlAddress:
+		r.control = value
+	case statusAddress:
+		r.status &^= value & StatusAlarm
+	default:
+		fmt.Printf("WARNING tried to write read only or unmapped RTC address %02X\n", address)
+	}
+}
+
+// AlarmFired is a callback meant for use by an interrupt controller
+func (r *RTC) AlarmFired() bool {
+	return r.status&StatusAlarm != 0
+}
+
+// Name returns the name of the device
+func (r *RTC) Name() string {
+	return "RTC"
+}
+
+// Interrupts returns the RTC's interrupt outputs
+func (r *RTC) Interrupts() []device.Interrupt {
+	return []device.Interrupt{
+		{Name: "AlarmFired", Asserted: r.AlarmFired},
+	}
+}
@@ -0,0 +1,108 @@
+package serialport
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// observerBufferSize is how many bytes may be queued for a slow
+// observer before bytes are dropped for that observer.  The simulated
+// port must never stall because somebody is watching.
+const observerBufferSize = 4096
+
+// observer receives a copy of every transmitted byte.
+// It never provides input to the serial port.
+type observer struct {
+	name    string
+	writer  io.Writer
+	channel chan []uint8
+	// isTelnet observers need 0xFF escaped
+	isTelnet bool
+}
+
+// observers is the set of read-only listeners on a SerialPort
+type observers struct {
+	mutex sync.Mutex
+	list  []*observer
+}
+
+// add starts a goroutine which copies queued bytes to w.
+// The observer is removed when a write to it fails.
+func (o *observers) add(name string, w io.Writer, isTelnet bool) {
+	ob := &observer{name: name, writer: w, isTelnet: isTelnet}
+	ob.channel = make(chan []uint8, observerBufferSize)
+
+	o.mutex.Lock()
+	o.list = append(o.list, ob)
+	o.mutex.Unlock()
+
+	go func() {
+		for b := range ob.channel {
+			if _, err := ob.writer.Write(b); err != nil {
+				fmt.Printf("Observer %s went away (%v)\n", ob.name, err)
+				o.remove(ob)
+				return
+			}
+		}
+	}()
+}
+
+// remove takes ob out of the list and stops its goroutine
+func (o *observers) remove(ob *observer) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for i, candidate := range o.list {
+		if candidate == ob {
+			o.list = append(o.list[:i], o.list[i+1:]...)
+			close(ob.channel)
+			return
+		}
+	}
+}
+
+// send queues b for every observer without blocking
+func (o *observers) send(b uint8) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for _, ob := range o.list {
+		data := []uint8{b}
+		if ob.isTelnet && b == telnetIAC {
+			data = append(data, telnetIAC)
+		}
+		select {
+		case ob.channel <- data:
+		default:
+			// Observer is too slow; it misses this byte
+		}
+	}
+}
+
+// listen accepts any number of read-only TCP observers on tcpPortNum.
+// Anything an observer types is read and discarded.
+func (o *observers) listen(portName string, tcpPortNum int, useTelnet bool) {
+	portString := fmt.Sprintf(":%d", tcpPortNum)
+	ln, err := net.Listen("tcp", portString)
+	if err != nil {
+		fmt.Printf("WARNING could not listen for observers of %s on %s\n", portName, portString)
+		return
+	}
+	fmt.Printf("   Observers of %s may connect to port :%d\n", portName, tcpPortNum)
+
+	go func() {
+		for {
+			connection, err := ln.Accept()
+			if err != nil {
+				continue
+			}
+			if useTelnet {
+				// Observers get the same terminal setup as the owner
+				var t telnet
+				t.init(connection)
+			}
+			o.add(connection.RemoteAddr().String(), connection, useTelnet)
+			go io.Copy(io.Discard, connection)
+		}
+	}()
+}
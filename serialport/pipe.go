@@ -0,0 +1,84 @@
+package serialport
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Pipe returns the two ends of an in-process serial line.  Unlike
+// net.Pipe, writes never block: each end buffers what it has been
+// sent until it is read.  This matters because Tick writes to the
+// connection while the other end may itself be waiting for the
+// serial port to take its bytes.
+func Pipe() (net.Conn, net.Conn) {
+	a := &pipeEnd{}
+	b := &pipeEnd{}
+	a.cond = sync.NewCond(&a.mutex)
+	b.cond = sync.NewCond(&b.mutex)
+	a.peer = b
+	b.peer = a
+	return a, b
+}
+
+// pipeEnd is one end of a Pipe.  buffer holds the bytes sent
+// to this end which have not been read yet.
+type pipeEnd struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	buffer   []byte
+	isClosed bool
+	peer     *pipeEnd
+}
+
+// pipeAddr is the address of both ends of a Pipe
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// Read blocks until there is something to read or the pipe is closed
+func (p *pipeEnd) Read(b []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for len(p.buffer) == 0 && !p.isClosed {
+		p.cond.Wait()
+	}
+	if len(p.buffer) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, p.buffer)
+	p.buffer = p.buffer[n:]
+	return n, nil
+}
+
+// Write adds b to the other end's buffer
+func (p *pipeEnd) Write(b []byte) (int, error) {
+	peer := p.peer
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	if peer.isClosed {
+		return 0, io.ErrClosedPipe
+	}
+	peer.buffer = append(peer.buffer, b...)
+	peer.cond.Broadcast()
+	return len(b), nil
+}
+
+// Close closes both ends.  Bytes already sent may still be read.
+func (p *pipeEnd) Close() error {
+	for _, end := range []*pipeEnd{p, p.peer} {
+		end.mutex.Lock()
+		end.isClosed = true
+		end.cond.Broadcast()
+		end.mutex.Unlock()
+	}
+	return nil
+}
+
+func (p *pipeEnd) LocalAddr() net.Addr                { return pipeAddr{} }
+func (p *pipeEnd) RemoteAddr() net.Addr               { return pipeAddr{} }
+func (p *pipeEnd) SetDeadline(t time.Time) error      { return nil }
+func (p *pipeEnd) SetReadDeadline(t time.Time) error  { return nil }
+func (p *pipeEnd) SetWriteDeadline(t time.Time) error { return nil }
@@ -1,8 +1,10 @@
 package serialport
 
 import (
+	"albert_go_sim/device"
 	"albert_go_sim/intmaxmin"
 	"fmt"
+	"io"
 	"net"
 	"runtime"
 	"time"
@@ -18,6 +20,38 @@ const (
 	numTXTicksPerByte = 1200
 )
 
+// Line status register bits (address 0xA).
+// The bits are sticky; they stay set until cleared by writing
+// a 1 to the corresponding bit of the line status register.
+const (
+	// RXOverrun is set when a byte arrived while the receive fifo was full.
+	// The newly arrived byte is dropped.
+	RXOverrun = 0x0001
+	// TXOverrun is set when the cpu wrote to a full transmit fifo.
+	// The written byte is dropped.
+	TXOverrun = 0x0002
+	// RXUnderrun is set when the cpu read from an empty receive fifo.
+	RXUnderrun = 0x0004
+)
+
+const lineStatusAddress = 0xA
+
+// Terminal size registers.  Only meaningful when UseTelnet is set
+// and the client sent its window size (NAWS); otherwise they read 0.
+const (
+	columnsAddress = 0xB
+	rowsAddress    = 0xC
+)
+
+// Misuse modes control how the serial port reacts when
+// software misuses it e.g. by writing to a full transmit fifo,
+// reading from an empty receive fifo or using an unmapped address.
+const (
+	MisuseWarn   = iota // print a WARNING and continue (the default)
+	MisuseFault  = iota // print a FATAL message and stop the simulation
+	MisuseSilent = iota // only update the line status register
+)
+
 // SerialPort provides virtual serial port implemented with TCP
 type SerialPort struct {
 	name                      string
@@ -31,6 +65,17 @@ type SerialPort struct {
 	isTransmitting            bool
 	timeToTransmit            int
 	transmitRegister          uint8
+	lineStatus                uint16
+	// MisuseMode is one of MisuseWarn, MisuseFault or MisuseSilent
+	MisuseMode int
+	// UseTelnet must be set before Init.  When true the port
+	// negotiates with (and strips negotiation from) a telnet client.
+	UseTelnet bool
+	telnet    telnet
+	// ObserverPort must be set before Init.  When non zero any number
+	// of read-only TCP clients may connect to it and see the output.
+	ObserverPort int
+	observers    observers
 }
 
 type fifo struct {
@@ -48,11 +93,16 @@ func (f *fifo) init(size int) {
 }
 
 // push adds an element to the fifo
-// No check is made to see if the fifo is full
-func (f *fifo) push(b uint8) {
+// If the fifo is full the new element is dropped (just like
+// the hardware) and false is returned.
+func (f *fifo) push(b uint8) bool {
+	if f.isFull() {
+		return false
+	}
 	f.data[f.in] = b
 	f.in = intmaxmin.IncMod(f.in, 1, len(f.data))
-	f.numElements = intmaxmin.Min(f.numElements+1, len(f.data))
+	f.numElements++
+	return true
 }
 
 // Pop gets the next item from the Fifo
@@ -89,10 +139,6 @@ func (f *fifo) clear() {
 // to report an error.
 func (s *SerialPort) Init(name string, tcpPortNum int) {
 	fmt.Printf("Initializing serial port %s with port :%d\n", name, tcpPortNum)
-	s.name = name
-
-	s.transmitFifo.init(transmitBufferSize)
-	s.receiveFifo.init(receiverBufferSize)
 
 	portString := fmt.Sprintf(":%d", tcpPortNum)
 	ln, err := net.Listen("tcp", portString)
@@ -106,20 +152,51 @@ func (s *SerialPort) Init(name string, tcpPortNum int) {
 		fmt.Printf("Fatal error could not listen for serial port")
 		panic("Done.")
 	}
-	s.serialConnection = connection
 	fmt.Printf("   Accept succeeded\n")
 	time.Sleep(1 * time.Second)
 
+	s.InitWithConnection(name, connection)
+}
+
+// InitWithConnection is an alternative to Init for when the
+// other end of the serial line is already connected, e.g.
+// an in-process device server on one end of a Pipe.
+func (s *SerialPort) InitWithConnection(name string, connection net.Conn) {
+	s.name = name
+
+	s.transmitFifo.init(transmitBufferSize)
+	s.receiveFifo.init(receiverBufferSize)
+
+	s.serialConnection = connection
+
 	s.numTicksSinceReception = 1000000
 	s.numTicksSinceTransmission = 0
 	s.inputChannel = make(chan uint8, 10)
 
+	if s.UseTelnet {
+		s.telnet.init(connection)
+	}
+
+	if s.ObserverPort != 0 {
+		s.observers.listen(name, s.ObserverPort, s.UseTelnet)
+	}
+
 	poll := func() {
 		b := make([]uint8, 1)
 
 		for {
-			s.serialConnection.Read(b)
-			s.inputChannel <- b[0]
+			_, err := s.serialConnection.Read(b)
+			if err != nil {
+				fmt.Printf("Serial port %s lost its connection (%v)\n", s.name, err)
+				return
+			}
+			if !s.UseTelnet {
+				s.inputChannel <- b[0]
+				continue
+			}
+			for _, d := range s.telnet.filter(b[0]) {
+				s.inputChannel <- d
+			}
 		}
 
 	}
@@ -134,6 +211,28 @@ func (s *SerialPort) Reset() {
 	s.transmitFifo.clear()
 	s.receiveFifo.clear()
 	s.isTransmitting = false
+	s.lineStatus = 0
+}
+
+// AddObserver attaches a read-only sink, e.g. a log file or a
+// test harness buffer, which receives a copy of every transmitted byte.
+// It may be called before or after Init.
+func (s *SerialPort) AddObserver(name string, w io.Writer) {
+	s.observers.add(name, w, false)
+}
+
+// misuse reports software misuse of the serial port
+// according to MisuseMode.  In MisuseFault mode it does not return.
+func (s *SerialPort) misuse(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if s.MisuseMode == MisuseSilent {
+		return
+	}
+	if s.MisuseMode == MisuseFault {
+		fmt.Printf("FATAL - %s in [%s]\n", message, s.name)
+		runtime.Goexit()
+	}
+	fmt.Printf("WARNING %s in [%s]\n", message, s.name)
 }
 
 // Tick should be called on every tick off the virtual clock
@@ -146,13 +245,15 @@ func (s *SerialPort) Tick() {
 	if s.numTicksSinceReception >= numRXTicksPerByte {
 		select {
 		case b := <-s.inputChannel:
-			if s.receiveFifo.isFull() {
-				fmt.Printf("WARNING receiver buffer is full.  Data overrun will occur.\n")
+			// An overrun is not a software error; it is a condition
+			// the driver is expected to detect via the line status register.
+			if !s.receiveFifo.push(b) {
+				s.lineStatus |= RXOverrun
+				if s.MisuseMode == MisuseWarn {
+					fmt.Printf("WARNING receiver buffer is full.  Byte %02X dropped in [%s].\n", b, s.name)
+				}
 			}
 
-			// byteNum++
-			s.receiveFifo.push(b)
-
 			s.numTicksSinceReception = 0
 		default:
 			break
@@ -172,7 +273,11 @@ func (s *SerialPort) Tick() {
 			// We don't transmit a bit at a time; we transmit the whole byte at the end.
 			var byteSlice []byte
 			byteSlice = append(byteSlice, s.transmitRegister)
+			if s.UseTelnet {
+				byteSlice = s.telnet.escape(s.transmitRegister)
+			}
 			s.serialConnection.Write(byteSlice)
+			s.observers.send(s.transmitRegister)
 			s.numTicksSinceTransmission = 0
 			s.isTransmitting = false
 		}
@@ -195,18 +300,23 @@ func (s *SerialPort) Tick() {
 
 // Write takes address and value.
 // 0 is the data port.
+// 0xA is the line status register; writing a 1 to a bit clears it.
 // no other address is valid.
 func (s *SerialPort) Write(address uint32, value uint16) {
-	if address != 0 {
-		fmt.Printf("WARNING Tried to write to serial port address %04x != 0; returning\n", address)
+	if address == lineStatusAddress {
+		s.lineStatus &^= value
 		return
 	}
 
-	if s.transmitFifo.isFull() {
-		fmt.Printf("WARNING you are writing to an already full serial transmit buffer; this will result in overrun\n")
+	if address != 0 {
+		s.misuse("tried to write to serial port address %04x", address)
+		return
 	}
 
-	s.transmitFifo.push(uint8(value))
+	if !s.transmitFifo.push(uint8(value)) {
+		s.lineStatus |= TXOverrun
+		s.misuse("wrote to full serial transmit buffer; byte %02X dropped", uint8(value))
+	}
 
 }
 
@@ -214,6 +324,8 @@ func (s *SerialPort) Write(address uint32, value uint16) {
 // 0 is the data port
 // 1 is the status port
 // 0x0002 (bit) is set when byte had been received
+// 0xA is the line status register (see RXOverrun etc.)
+// 0xB and 0xC are the telnet window columns and rows
 func (s *SerialPort) Read(address uint32) uint16 {
 
 	value := uint16(0)
@@ -221,7 +333,8 @@ func (s *SerialPort) Read(address uint32) uint16 {
 		// User wants to read received serial data.
 		// Do some sanity checks along the way
 		if s.receiveFifo.isEmpty() {
-			fmt.Printf("WARNING trying to read from empty serial receive buffer; returning\n")
+			s.lineStatus |= RXUnderrun
+			s.misuse("tried to read from empty serial receive buffer")
 			return 0
 		}
 
@@ -302,6 +415,21 @@ func (s *SerialPort) Read(address uint32) uint16 {
 		return value
 	}
 
+	if address == lineStatusAddress {
+		return s.lineStatus
+	}
+
+	if address == columnsAddress || address == rowsAddress {
+		if !s.UseTelnet {
+			return 0
+		}
+		columns, rows := s.telnet.windowSize()
+		if address == columnsAddress {
+			return columns
+		}
+		return rows
+	}
+
 	if address == 0xE {
 		return uint16(s.receiveFifo.numElements)
 	}
@@ -310,6 +438,7 @@ func (s *SerialPort) Read(address uint32) uint16 {
 		return uint16(s.transmitFifo.numElements)
 	}
 
+	// Address decoding errors are always fatal whatever the MisuseMode
 	fmt.Printf("FATAL - tried to read from unmapped serial port address %02X in [%s]\n", address, s.name)
 	runtime.Goexit()
 
@@ -326,3 +455,42 @@ func (s *SerialPort) RXIsQuarterFull() bool {
 	// Note the hardware checks for numElements >= 1/4 full
 	return s.receiveFifo.numElements >= receiverBufferSize/4
 }
+
+// RXIsNotEmpty is a callback meant for use by an interrupt controller
+func (s *SerialPort) RXIsNotEmpty() bool {
+	return !s.receiveFifo.isEmpty()
+}
+
+// RXHasOverrun is a callback meant for use by an interrupt controller
+// It stays asserted until RXOverrun is cleared in the line status register.
+func (s *SerialPort) RXHasOverrun() bool {
+	return s.lineStatus&RXOverrun != 0
+}
+
+// TXIsEmpty is a callback meant for use by an interrupt controller
+// Note it only checks the fifo; the last byte may still be "on the wire".
+func (s *SerialPort) TXIsEmpty() bool {
+	return s.transmitFifo.isEmpty()
+}
+
+// TXIsBelowHalf is a callback meant for use by an interrupt controller
+func (s *SerialPort) TXIsBelowHalf() bool {
+	return s.transmitFifo.numElements < transmitBufferSize/2
+}
+
+// Name returns the name given to Init
+func (s *SerialPort) Name() string {
+	return s.name
+}
+
+// Interrupts returns the serial port's interrupt outputs
+func (s *SerialPort) Interrupts() []device.Interrupt {
+	return []device.Interrupt{
+		{Name: "RXIsHalfFull", Asserted: s.RXIsHalfFull},
+		{Name: "RXIsQuarterFull", Asserted: s.RXIsQuarterFull},
+		{Name: "RXIsNotEmpty", Asserted: s.RXIsNotEmpty},
+		{Name: "RXHasOverrun", Asserted: s.RXHasOverrun},
+		{Name: "TXIsEmpty", Asserted: s.TXIsEmpty},
+		{Name: "TXIsBelowHalf", Asserted: s.TXIsBelowHalf},
+	}
+}
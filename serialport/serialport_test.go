@@ -0,0 +1,171 @@
+package serialport
+
+import "testing"
+
+// newTestPort returns a serial port with no connection.
+// Bytes arrive through receive; nothing may be transmitted.
+func newTestPort(misuseMode int) *SerialPort {
+	s := &SerialPort{name: "test", MisuseMode: misuseMode}
+	s.transmitFifo.init(transmitBufferSize)
+	s.receiveFifo.init(receiverBufferSize)
+	s.inputChannel = make(chan uint8, 1)
+	return s
+}
+
+// receive delivers b as if it had just arrived on the line
+func receive(s *SerialPort, b uint8) {
+	s.inputChannel <- b
+	s.numTicksSinceReception = numRXTicksPerByte
+	s.Tick()
+}
+
+// returns reports whether f returns rather than stopping its
+// goroutine the way a FATAL error does
+func returns(f func()) bool {
+	done := make(chan bool)
+	go func() {
+		hasReturned := false
+		defer func() { done <- hasReturned }()
+		f()
+		hasReturned = true
+	}()
+	return <-done
+}
+
+func TestRXOverrunDropsNewest(t *testing.T) {
+	s := newTestPort(MisuseSilent)
+	for i := 0; i < receiverBufferSize; i++ {
+		receive(s, uint8(i))
+	}
+	if s.Read(lineStatusAddress)&RXOverrun != 0 {
+		t.Fatalf("overrun before the fifo was full")
+	}
+
+	receive(s, 0xEE)
+	if s.Read(lineStatusAddress)&RXOverrun == 0 {
+		t.Fatalf("no overrun when a byte arrived at a full fifo")
+	}
+	if n := s.Read(0xE); n != receiverBufferSize {
+		t.Fatalf("fifo holds %d bytes; want %d", n, receiverBufferSize)
+	}
+	for i := 0; i < receiverBufferSize; i++ {
+		if b := s.Read(0); b != uint16(uint8(i)) {
+			t.Fatalf("byte %d is %02X; want %02X (the newest byte should be dropped)", i, b, uint8(i))
+		}
+	}
+
+	// Sticky until cleared
+	if s.Read(lineStatusAddress)&RXOverrun == 0 {
+		t.Fatalf("overrun did not stay set after the fifo drained")
+	}
+}
+
+func TestTXOverrun(t *testing.T) {
+	s := newTestPort(MisuseSilent)
+	for i := 0; i < transmitBufferSize; i++ {
+		s.Write(0, uint16(i))
+	}
+	if s.Read(lineStatusAddress)&TXOverrun != 0 {
+		t.Fatalf("overrun before the fifo was full")
+	}
+	if s.Read(5) != 1 {
+		t.Fatalf("transmit fifo full register did not read 1")
+	}
+
+	s.Write(0, 0xEE)
+	if s.Read(lineStatusAddress)&TXOverrun == 0 {
+		t.Fatalf("no overrun when writing to a full fifo")
+	}
+	if n := s.Read(0xF); n != transmitBufferSize {
+		t.Fatalf("fifo holds %d bytes; want %d", n, transmitBufferSize)
+	}
+}
+
+func TestRXUnderrun(t *testing.T) {
+	s := newTestPort(MisuseSilent)
+	if b := s.Read(0); b != 0 {
+		t.Fatalf("read from empty fifo returned %02X; want 0", b)
+	}
+	if s.Read(lineStatusAddress)&RXUnderrun == 0 {
+		t.Fatalf("no underrun after reading an empty fifo")
+	}
+}
+
+func TestStatusRegisters(t *testing.T) {
+	s := newTestPort(MisuseSilent)
+	if got := s.Read(1); got != 0x0001 {
+		t.Fatalf("compatibility status is %04X with empty fifos; want 0001", got)
+	}
+	if s.Read(6) != 1 || s.Read(2) != 1 {
+		t.Fatalf("empty fifos do not read as empty")
+	}
+
+	receive(s, 'A')
+	if got := s.Read(1); got != 0x0003 {
+		t.Fatalf("compatibility status is %04X with a received byte; want 0003", got)
+	}
+	if s.Read(6) != 0 || s.Read(0xE) != 1 {
+		t.Fatalf("receive fifo does not show one byte")
+	}
+	for i := 1; i < receiverBufferSize/4; i++ {
+		receive(s, 'A')
+	}
+	if s.Read(8) != 1 || s.Read(7) != 0 {
+		t.Fatalf("receive fifo is a quarter full but reads quarter %d half %d", s.Read(8), s.Read(7))
+	}
+}
+
+func TestLineStatusClear(t *testing.T) {
+	s := newTestPort(MisuseSilent)
+	s.Read(0)
+	for i := 0; i <= transmitBufferSize; i++ {
+		s.Write(0, 0)
+	}
+	if got := s.Read(lineStatusAddress); got != TXOverrun|RXUnderrun {
+		t.Fatalf("line status is %04X; want %04X", got, TXOverrun|RXUnderrun)
+	}
+
+	s.Write(lineStatusAddress, RXUnderrun)
+	if got := s.Read(lineStatusAddress); got != TXOverrun {
+		t.Fatalf("line status is %04X after clearing RXUnderrun; want %04X", got, TXOverrun)
+	}
+	s.Write(lineStatusAddress, TXOverrun)
+	if got := s.Read(lineStatusAddress); got != 0 {
+		t.Fatalf("line status is %04X after clearing TXOverrun; want 0", got)
+	}
+}
+
+func TestMisuseModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        int
+		wantReturns bool
+	}{
+		{"warn", MisuseWarn, true},
+		{"silent", MisuseSilent, true},
+		{"fault", MisuseFault, false},
+	}
+	for _, test := range tests {
+		s := newTestPort(test.mode)
+		if got := returns(func() { s.Read(0) }); got != test.wantReturns {
+			t.Errorf("%s: reading an empty fifo returned %v; want %v", test.name, got, test.wantReturns)
+		}
+		if s.Read(lineStatusAddress)&RXUnderrun == 0 {
+			t.Errorf("%s: underrun not recorded", test.name)
+		}
+
+		s = newTestPort(test.mode)
+		if got := returns(func() { s.Write(3, 0) }); got != test.wantReturns {
+			t.Errorf("%s: writing an unmapped address returned %v; want %v", test.name, got, test.wantReturns)
+		}
+	}
+}
+
+func TestUnmappedReadIsAlwaysFatal(t *testing.T) {
+	for _, mode := range []int{MisuseWarn, MisuseFault, MisuseSilent} {
+		s := newTestPort(mode)
+		if returns(func() { s.Read(0xD) }) {
+			t.Errorf("misuse mode %d: reading unmapped address 0D returned", mode)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package serialport
+
+import (
+	"net"
+	"sync"
+)
+
+// Telnet command and option codes (RFC 854, 857, 858, 1073)
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptionEcho = 1
+	telnetOptionSGA  = 3
+	telnetOptionNAWS = 31
+)
+
+// States of the telnet input filter
+const (
+	telnetStateData   = iota
+	telnetStateIAC    = iota
+	telnetStateOption = iota
+	telnetStateSB     = iota
+	telnetStateSBIAC  = iota
+	telnetStateCR     = iota
+)
+
+// telnetMaxSubnegotiation limits how much of an SB sequence is kept
+const telnetMaxSubnegotiation = 16
+
+// telnet strips and answers telnet negotiation on the
+// TCP side of a SerialPort so a stock telnet client behaves
+// like a raw terminal: character at a time, remote echo.
+type telnet struct {
+	connection net.Conn
+	state      int
+	command    uint8
+	subData    []uint8
+	// localEnabled holds options we (the server) perform
+	localEnabled map[uint8]bool
+	// remoteEnabled holds options the client performs
+	remoteEnabled  map[uint8]bool
+	remoteAskedFor map[uint8]bool
+
+	mutex   sync.Mutex
+	columns uint16
+	rows    uint16
+}
+
+// init sends the initial negotiation to the client.
+// We offer to echo and to suppress go ahead (together they put
+// most clients in character mode) and ask for the window size.
+func (t *telnet) init(connection net.Conn) {
+	t.connection = connection
+	t.state = telnetStateData
+	t.localEnabled = make(map[uint8]bool)
+	t.remoteEnabled = make(map[uint8]bool)
+	t.remoteAskedFor = make(map[uint8]bool)
+
+	t.localEnabled[telnetOptionEcho] = true
+	t.localEnabled[telnetOptionSGA] = true
+	t.remoteAskedFor[telnetOptionNAWS] = true
+	t.send(telnetWILL, telnetOptionEcho)
+	t.send(telnetWILL, telnetOptionSGA)
+	t.send(telnetDO, telnetOptionNAWS)
+}
+
+// send writes a three byte IAC command to the client
+func (t *telnet) send(command uint8, option uint8) {
+	t.connection.Write([]byte{telnetIAC, command, option})
+}
+
+// filter takes a byte from the client and returns the data bytes
+// (if any) it represents.  Negotiation bytes are consumed and answered.
+func (t *telnet) filter(b uint8) []uint8 {
+	switch t.state {
+	case telnetStateData:
+		if b == telnetIAC {
+			t.state = telnetStateIAC
+			return nil
+		}
+		if b == '\r' {
+			t.state = telnetStateCR
+		}
+		return []uint8{b}
+
+	case telnetStateCR:
+		// Telnet sends CR as CR NUL; the NUL is not data.
+		t.state = telnetStateData
+		if b == 0 {
+			return nil
+		}
+		return t.filter(b)
+
+	case telnetStateIAC:
+		switch b {
+		case telnetIAC:
+			// Escaped 0xFF is data
+			t.state = telnetStateData
+			return []uint8{telnetIAC}
+		case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+			t.command = b
+			t.state = telnetStateOption
+		case telnetSB:
+			t.subData = t.subData[:0]
+			t.state = telnetStateSB
+		default:
+			// Two byte commands e.g. NOP, GA, AYT are ignored
+			t.state = telnetStateData
+		}
+		return nil
+
+	case telnetStateOption:
+		t.negotiate(t.command, b)
+		t.state = telnetStateData
+		return nil
+
+	case telnetStateSB:
+		if b == telnetIAC {
+			t.state = telnetStateSBIAC
+			return nil
+		}
+		if len(t.subData) < telnetMaxSubnegotiation {
+			t.subData = append(t.subData, b)
+		}
+		return nil
+
+	case telnetStateSBIAC:
+		if b == telnetSE {
+			t.subnegotiation()
+			t.state = telnetStateData
+			return nil
+		}
+		// IAC IAC inside a subnegotiation is an escaped 0xFF
+		if len(t.subData) < telnetMaxSubnegotiation {
+			t.subData = append(t.subData, b)
+		}
+		t.state = telnetStateSB
+		return nil
+	}
+
+	t.state = telnetStateData
+	return nil
+}
+
+// negotiate answers a WILL/WONT/DO/DONT from the client.
+// Replies are only sent when an option changes state so
+// the two sides can not loop forever.
+func (t *telnet) negotiate(command uint8, option uint8) {
+	switch command {
+	case telnetDO:
+		if option == telnetOptionEcho || option == telnetOptionSGA {
+			if !t.localEnabled[option] {
+				t.localEnabled[option] = true
+				t.send(telnetWILL, option)
+			}
+			return
+		}
+		t.send(telnetWONT, option)
+
+	case telnetDONT:
+		if t.localEnabled[option] {
+			t.localEnabled[option] = false
+			t.send(telnetWONT, option)
+		}
+
+	case telnetWILL:
+		if option == telnetOptionNAWS || option == telnetOptionSGA {
+			if !t.remoteEnabled[option] {
+				t.remoteEnabled[option] = true
+				if !t.remoteAskedFor[option] {
+					t.send(telnetDO, option)
+				}
+			}
+			return
+		}
+		t.send(telnetDONT, option)
+
+	case telnetWONT:
+		if t.remoteEnabled[option] {
+			t.remoteEnabled[option] = false
+			t.send(telnetDONT, option)
+		}
+	}
+}
+
+// subnegotiation handles a complete IAC SB ... IAC SE sequence.
+// Only NAWS (window size) is understood.
+func (t *telnet) subnegotiation() {
+	if len(t.subData) != 5 || t.subData[0] != telnetOptionNAWS {
+		return
+	}
+	t.mutex.Lock()
+	t.columns = uint16(t.subData[1])<<8 | uint16(t.subData[2])
+	t.rows = uint16(t.subData[3])<<8 | uint16(t.subData[4])
+	t.mutex.Unlock()
+}
+
+// windowSize returns the last size reported by the client (0 if unknown)
+func (t *telnet) windowSize() (uint16, uint16) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.columns, t.rows
+}
+
+// escape returns b as it should be sent to a telnet client
+func (t *telnet) escape(b uint8) []uint8 {
+	if b == telnetIAC {
+		return []uint8{telnetIAC, telnetIAC}
+	}
+	return []uint8{b}
+}
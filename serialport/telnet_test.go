@@ -0,0 +1,142 @@
+package serialport
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// newTestTelnet returns a telnet filter and the client's end of
+// its connection with the initial negotiation already read
+func newTestTelnet(t *testing.T) (*telnet, io.Reader) {
+	server, client := Pipe()
+	var tn telnet
+	tn.init(server)
+	initial := make([]byte, 9)
+	if _, err := io.ReadFull(client, initial); err != nil {
+		t.Fatal(err)
+	}
+	return &tn, client
+}
+
+// replies returns everything the filter has sent the client so far
+func replies(t *testing.T, tn *telnet, client io.Reader) []byte {
+	tn.connection.Close()
+	data, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestTelnetFilter(t *testing.T) {
+	const (
+		iac  = telnetIAC
+		will = telnetWILL
+		wont = telnetWONT
+		do   = telnetDO
+		dont = telnetDONT
+		sb   = telnetSB
+		se   = telnetSE
+		naws = telnetOptionNAWS
+	)
+	tests := []struct {
+		name        string
+		reads       [][]byte // each is one read from the connection
+		wantData    []byte
+		wantReplies []byte
+		wantColumns uint16
+		wantRows    uint16
+	}{
+		{
+			name:     "plain data",
+			reads:    [][]byte{[]byte("ab")},
+			wantData: []byte("ab"),
+		},
+		{
+			name:     "IAC IAC is a data FF",
+			reads:    [][]byte{{'a', iac, iac, 'b'}},
+			wantData: []byte{'a', 0xFF, 'b'},
+		},
+		{
+			name:     "IAC IAC split across reads",
+			reads:    [][]byte{{'a', iac}, {iac, 'b'}},
+			wantData: []byte{'a', 0xFF, 'b'},
+		},
+		{
+			name:     "two byte command is dropped",
+			reads:    [][]byte{{'a', iac, 241, 'b'}},
+			wantData: []byte("ab"),
+		},
+		{
+			name:        "unknown option is refused",
+			reads:       [][]byte{{iac, do, 6, 'x'}},
+			wantData:    []byte("x"),
+			wantReplies: []byte{iac, wont, 6},
+		},
+		{
+			name:        "option split across reads",
+			reads:       [][]byte{{iac}, {will}, {24}, {'x'}},
+			wantData:    []byte("x"),
+			wantReplies: []byte{iac, dont, 24},
+		},
+		{
+			name:     "agreeing to what we asked for is not answered",
+			reads:    [][]byte{{iac, will, naws, iac, do, telnetOptionEcho}},
+			wantData: nil,
+		},
+		{
+			name:        "window size",
+			reads:       [][]byte{{iac, sb, naws, 0, 80, 0, 24, iac, se, 'x'}},
+			wantData:    []byte("x"),
+			wantColumns: 80,
+			wantRows:    24,
+		},
+		{
+			name:        "window size split across reads with an escaped FF",
+			reads:       [][]byte{{iac, sb, naws, 0}, {iac, iac, 0}, {50, iac}, {se}},
+			wantColumns: 0xFF,
+			wantRows:    50,
+		},
+		{
+			name:     "CR NUL is CR",
+			reads:    [][]byte{{'\r', 0, 'a', '\r', '\n'}},
+			wantData: []byte{'\r', 'a', '\r', '\n'},
+		},
+		{
+			name:     "CR followed by IAC IAC",
+			reads:    [][]byte{{'\r'}, {iac, iac}},
+			wantData: []byte{'\r', 0xFF},
+		},
+	}
+
+	for _, test := range tests {
+		tn, client := newTestTelnet(t)
+		var data []byte
+		for _, read := range test.reads {
+			for _, b := range read {
+				data = append(data, tn.filter(b)...)
+			}
+		}
+		if !bytes.Equal(data, test.wantData) {
+			t.Errorf("%s: data is % X; want % X", test.name, data, test.wantData)
+		}
+		columns, rows := tn.windowSize()
+		if columns != test.wantColumns || rows != test.wantRows {
+			t.Errorf("%s: window is %dx%d; want %dx%d", test.name, columns, rows, test.wantColumns, test.wantRows)
+		}
+		if got := replies(t, tn, client); !bytes.Equal(got, test.wantReplies) {
+			t.Errorf("%s: replies are % X; want % X", test.name, got, test.wantReplies)
+		}
+	}
+}
+
+func TestTelnetEscape(t *testing.T) {
+	var tn telnet
+	if got := tn.escape(0xFF); !bytes.Equal(got, []byte{0xFF, 0xFF}) {
+		t.Errorf("escape(FF) is % X; want FF FF", got)
+	}
+	if got := tn.escape('a'); !bytes.Equal(got, []byte{'a'}) {
+		t.Errorf("escape('a') is % X; want 61", got)
+	}
+}
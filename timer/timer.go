@@ -0,0 +1,137 @@
+package timer
+
+import (
+	"albert_go_sim/device"
+	"fmt"
+)
+
+// Register addresses within the chip select
+const (
+	controlAddress   = 0
+	prescalerAddress = 1
+	compareAddress   = 2
+	reloadAddress    = 3
+	countAddress     = 4
+	statusAddress    = 5
+)
+
+// Control register bits
+const (
+	ControlEnable          = 0x0001
+	ControlPeriodic        = 0x0002
+	ControlInterruptEnable = 0x0004
+)
+
+// StatusMatch is set when count reaches compare.
+// It is sticky; write a 1 to it in the status register to clear it.
+const StatusMatch = 0x0001
+
+// Timer is a memory mapped programmable timer.
+// Every (prescaler+1) ticks count is incremented.  When count
+// reaches compare StatusMatch is set and count is set to reload.
+// In one-shot mode (ControlPeriodic clear) the timer then disables itself.
+type Timer struct {
+	control   uint16
+	prescaler uint16
+	compare   uint16
+	reload    uint16
+	count     uint16
+	status    uint16
+	tickNum   uint16
+}
+
+// Init the timer
+func (t *Timer) Init() {
+	fmt.Printf("Initializing Timer\n")
+}
+
+// Reset stops the timer and clears its registers
+func (t *Timer) Reset() {
+	*t = Timer{}
+}
+
+// Tick should be called on every tick off the virtual clock
+func (t *Timer) Tick() {
+	if t.control&ControlEnable == 0 {
+		return
+	}
+	if t.tickNum < t.prescaler {
+		t.tickNum++
+		return
+	}
+	t.tickNum = 0
+
+	t.count++
+	if t.count != t.compare {
+		return
+	}
+	t.status |= StatusMatch
+	t.count = t.reload
+	if t.control&ControlPeriodic == 0 {
+		t.control &^= ControlEnable
+	}
+}
+
+// Read takes address and returns a value
+// Addresses are defined above
+func (t *Timer) Read(address uint32) uint16 {
+	switch address {
+	case controlAddress:
+		return t.control
+	case prescalerAddress:
+		return t.prescaler
+	case compareAddress:
+		return t.compare
+	case reloadAddress:
+		return t.reload
+	case countAddress:
+		return t.count
+	case statusAddress:
+		return t.status
+	}
+	fmt.Printf("WARNING tried to read unmapped timer address %02X\n", address)
+	return 0
+}
+
+// Write takes an address and a value
+// Enabling the timer loads count from reload and restarts the prescaler.
+func (t *Timer) Write(address uint32, value uint16) {
+	switch address {
+	case controlAddress:
+		if t.control&ControlEnable == 0 && value&ControlEnable != 0 {
+			t.count = t.reload
+			t.tickNum = 0
+		}
+		t.control = value
+	case prescalerAddress:
+		t.prescaler = value
+	case compareAddress:
+		t.compare = value
+	case reloadAddress:
+		t.reload = value
+	case countAddress:
+		t.count = value
+	case statusAddress:
+		t.status &^= value & StatusMatch
+	default:
+		fmt.Printf("WARNING tried to write unmapped timer address %02X\n", address)
+	}
+}
+
+// HasMatched is a callback meant for use by an interrupt controller
+// It is asserted while StatusMatch is set and interrupts are enabled.
+func (t *Timer) HasMatched() bool {
+	return t.status&StatusMatch != 0 && t.control&ControlInterruptEnable != 0
+}
+
+// Name returns the name of the device
+func (t *Timer) Name() string {
+	return "Timer"
+}
+
+// Interrupts returns the timer's interrupt outputs
+func (t *Timer) Interrupts() []device.Interrupt {
+	return []device.Interrupt{
+		{Name: "HasMatched", Asserted: t.HasMatched},
+	}
+}
@@ -0,0 +1,160 @@
+// Package trace reads and writes execution traces.
+// A trace is a sequence of entries, one per instruction, in either
+// JSON Lines (one JSON object per line) or a compact binary format.
+//
+// The binary format is the 8 byte magic "ALBTRC01" followed by
+// fixed size big endian records in the order of the Entry fields
+// (Mnemonic is not stored).
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Trace formats
+const (
+	JSONLFormat  = "jsonl"
+	BinaryFormat = "binary"
+)
+
+// binaryMagic starts every binary trace
+var binaryMagic = []byte("ALBTRC01")
+
+// Entry is the state of the cpu when it executed one instruction.
+// Index 0 of the stacks is the top of stack (PTOS and RTOS).
+type Entry struct {
+	Seq      uint64    `json:"seq"`
+	Address  uint32    `json:"address"`
+	Opcode   uint16    `json:"opcode"`
+	Inline   uint16    `json:"inline"`
+	Left     uint16    `json:"left"`
+	Right    uint16    `json:"right"`
+	PStack   [4]uint16 `json:"pstack"`
+	RStack   [4]uint16 `json:"rstack"`
+	PC       uint16    `json:"pc"`
+	PSP      uint16    `json:"psp"`
+	RSP      uint16    `json:"rsp"`
+	CS       uint16    `json:"cs"`
+	DS       uint16    `json:"ds"`
+	ES       uint16    `json:"es"`
+	Flags    uint8     `json:"flags"`
+	Mnemonic string    `json:"mnemonic,omitempty"`
+}
+
+// binaryEntry is the record stored in binary traces
+type binaryEntry struct {
+	Seq     uint64
+	Address uint32
+	Opcode  uint16
+	Inline  uint16
+	Left    uint16
+	Right   uint16
+	PStack  [4]uint16
+	RStack  [4]uint16
+	PC      uint16
+	PSP     uint16
+	RSP     uint16
+	CS      uint16
+	DS      uint16
+	ES      uint16
+	Flags   uint8
+}
+
+// Writer writes entries in one of the formats
+type Writer struct {
+	w      *bufio.Writer
+	format string
+}
+
+// NewWriter returns a Writer for format.  Call Flush when done.
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	t := Writer{w: bufio.NewWriter(w), format: format}
+	switch format {
+	case JSONLFormat:
+	case BinaryFormat:
+		if _, err := t.w.Write(binaryMagic); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown trace format %q", format)
+	}
+	return &t, nil
+}
+
+// Write writes one entry
+func (t *Writer) Write(e *Entry) error {
+	if t.format == BinaryFormat {
+		b := binaryEntry{e.Seq, e.Address, e.Opcode, e.Inline, e.Left, e.Right, e.PStack, e.RStack,
+			e.PC, e.PSP, e.RSP, e.CS, e.DS, e.ES, e.Flags}
+		return binary.Write(t.w, binary.BigEndian, &b)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = t.w.Write(data)
+	return err
+}
+
+// Flush writes any buffered entries
+func (t *Writer) Flush() error {
+	return t.w.Flush()
+}
+
+// Reader reads entries in either format
+type Reader struct {
+	r        *bufio.Reader
+	isBinary bool
+	lineNum  int
+}
+
+// NewReader returns a Reader.  The format is detected from the contents.
+func NewReader(r io.Reader) (*Reader, error) {
+	t := Reader{r: bufio.NewReader(r)}
+	magic, err := t.r.Peek(len(binaryMagic))
+	if err == nil && bytes.Equal(magic, binaryMagic) {
+		t.isBinary = true
+		t.r.Discard(len(binaryMagic))
+	}
+	return &t, nil
+}
+
+// Read returns the next entry or io.EOF at the end of the trace
+func (t *Reader) Read() (*Entry, error) {
+	if t.isBinary {
+		var b binaryEntry
+		if err := binary.Read(t.r, binary.BigEndian, &b); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("binary trace ends part way through an entry")
+			}
+			return nil, err
+		}
+		e := Entry{b.Seq, b.Address, b.Opcode, b.Inline, b.Left, b.Right, b.PStack, b.RStack,
+			b.PC, b.PSP, b.RSP, b.CS, b.DS, b.ES, b.Flags, ""}
+		return &e, nil
+	}
+
+	for {
+		line, err := t.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		t.lineNum++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("line %d: %v", t.lineNum, err)
+		}
+		return &e, nil
+	}
+}
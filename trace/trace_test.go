@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEntries returns entries with every field set
+func testEntries() []Entry {
+	return []Entry{
+		{Seq: 1, Address: 0x00400, Opcode: 0x000A, Inline: 0x0500, Left: 1, Right: 2,
+			PStack: [4]uint16{1, 2, 3, 4}, RStack: [4]uint16{5, 6, 7, 8},
+			PC: 0x0401, PSP: 0xFF00, RSP: 0xFE00, CS: 0, DS: 0x1000, ES: 0x2000, Flags: 3},
+		{Seq: 2, Address: 0xF0500, Opcode: 0xFFFF, Inline: 0xFFFF, Left: 0xFFFF, Right: 0xFFFF,
+			PStack: [4]uint16{0xFFFF}, RStack: [4]uint16{0, 0, 0, 0xFFFF},
+			PC: 0xFFFF, PSP: 1, RSP: 2, CS: 0xF000, DS: 0xFFFF, ES: 0xFFFF, Flags: 0xFF},
+	}
+}
+
+// writeEntries writes entries in format and returns the trace
+func writeEntries(t *testing.T, format string, entries []Entry) []byte {
+	var b bytes.Buffer
+	w, err := NewWriter(&b, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entries {
+		if err := w.Write(&entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// readEntries reads every entry in data
+func readEntries(data []byte) ([]Entry, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		e, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, *e)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{JSONLFormat, BinaryFormat} {
+		data := writeEntries(t, format, testEntries())
+		got, err := readEntries(data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !reflect.DeepEqual(got, testEntries()) {
+			t.Errorf("%s: read %+v; want %+v", format, got, testEntries())
+		}
+	}
+}
+
+func TestMnemonicOnlyInJSONL(t *testing.T) {
+	entries := []Entry{{Seq: 1, Mnemonic: "JSR"}}
+	got, err := readEntries(writeEntries(t, JSONLFormat, entries))
+	if err != nil || len(got) != 1 || got[0].Mnemonic != "JSR" {
+		t.Errorf("jsonl: read %+v, %v; want mnemonic JSR", got, err)
+	}
+	got, err = readEntries(writeEntries(t, BinaryFormat, entries))
+	if err != nil || len(got) != 1 || got[0].Mnemonic != "" {
+		t.Errorf("binary: read %+v, %v; want no mnemonic", got, err)
+	}
+}
+
+func TestEmptyTraces(t *testing.T) {
+	for _, format := range []string{JSONLFormat, BinaryFormat} {
+		got, err := readEntries(writeEntries(t, format, nil))
+		if err != nil || len(got) != 0 {
+			t.Errorf("%s: read %+v, %v; want nothing", format, got, err)
+		}
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	binaryTrace := writeEntries(t, BinaryFormat, testEntries())
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"truncated binary entry", binaryTrace[:len(binaryTrace)-1], "part way through an entry"},
+		{"bad JSON line", []byte("{\"seq\":1}\n\n{\"seq\":\n"), "line 3"},
+		{"wrong JSON type", []byte("{\"seq\":\"one\"}\n"), "line 1"},
+	}
+	for _, test := range tests {
+		_, err := readEntries(test.data)
+		if err == nil {
+			t.Errorf("%s: read without error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %q does not mention %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(io.Discard, "text"); err == nil {
+		t.Errorf("NewWriter accepted format text")
+	}
+}
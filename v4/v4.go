@@ -0,0 +1,224 @@
+// Package v4 reads and writes V4 object files.
+//
+// A V4 file is a sequence of big endian 16 bit words:
+//
+//	0000 0004                     magic
+//	code size, code load address, code start address
+//	data size, data load address
+//	code words
+//	data words
+package v4
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Magic words at the start of every V4 file
+const (
+	Magic1 = 0x0000
+	Magic2 = 0x0004
+)
+
+// HeaderSize is the size of the header (including the magic) in words
+const HeaderSize = 7
+
+// Header describes the code and data sections
+type Header struct {
+	CodeSize         uint16
+	CodeLoadAddress  uint16
+	CodeStartAddress uint16
+	DataSize         uint16
+	DataLoadAddress  uint16
+}
+
+// File is a whole V4 object file
+type File struct {
+	Header
+	Code []uint16
+	Data []uint16
+}
+
+// Machine is what a V4 file is loaded into
+type Machine interface {
+	// CheckWritable returns an error unless count words
+	// from start can be written
+	CheckWritable(start uint32, count uint32) error
+	Write(address uint32, value uint16)
+	SetPC(pc uint16)
+}
+
+// IsV4 reports whether data starts with the V4 magic
+func IsV4(data []byte) bool {
+	return len(data) >= 4 && uint16(data[0])<<8|uint16(data[1]) == Magic1 && uint16(data[2])<<8|uint16(data[3]) == Magic2
+}
+
+// Parse decodes a V4 file.  Anything other than exactly the
+// number of bytes the header calls for is an error.
+func Parse(data []byte) (*File, error) {
+	word := func(i int) uint16 {
+		return uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+
+	if len(data) < 2*HeaderSize {
+		return nil, fmt.Errorf("V4 file is %d bytes; too small for the %d byte header", len(data), 2*HeaderSize)
+	}
+	if word(0) != Magic1 || word(1) != Magic2 {
+		return nil, fmt.Errorf("incorrect V4 magic %04X %04X expected %04X:%04X", word(0), word(1), Magic1, Magic2)
+	}
+
+	var f File
+	f.CodeSize = word(2)
+	f.CodeLoadAddress = word(3)
+	f.CodeStartAddress = word(4)
+	f.DataSize = word(5)
+	f.DataLoadAddress = word(6)
+
+	requiredSize := f.Size()
+	if len(data) < requiredSize {
+		return nil, fmt.Errorf("V4 file is truncated; it is %d bytes but its header says %d", len(data), requiredSize)
+	}
+	if len(data) > requiredSize {
+		return nil, fmt.Errorf("V4 file has %d bytes after the data section", len(data)-requiredSize)
+	}
+
+	f.Code = make([]uint16, f.CodeSize)
+	for i := range f.Code {
+		f.Code[i] = word(HeaderSize + i)
+	}
+	f.Data = make([]uint16, f.DataSize)
+	for i := range f.Data {
+		f.Data[i] = word(HeaderSize + int(f.CodeSize) + i)
+	}
+	return &f, nil
+}
+
+// ReadFile reads and parses the V4 file fileName
+func ReadFile(fileName string) (*File, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return f, nil
+}
+
+// New returns a V4 file with the header filled in from code and data
+func New(code []uint16, codeLoadAddress uint16, codeStartAddress uint16, data []uint16, dataLoadAddress uint16) *File {
+	return &File{
+		Header: Header{
+			CodeSize:         uint16(len(code)),
+			CodeLoadAddress:  codeLoadAddress,
+			CodeStartAddress: codeStartAddress,
+			DataSize:         uint16(len(data)),
+			DataLoadAddress:  dataLoadAddress,
+		},
+		Code: code,
+		Data: data,
+	}
+}
+
+// Size returns the size in bytes of the file described by the header
+func (h *Header) Size() int {
+	return 2 * (HeaderSize + int(h.CodeSize) + int(h.DataSize))
+}
+
+// Validate checks the header agrees with the sections
+func (f *File) Validate() error {
+	if len(f.Code) > 0xFFFF || len(f.Data) > 0xFFFF {
+		return fmt.Errorf("V4 sections are limited to FFFF words")
+	}
+	if int(f.CodeSize) != len(f.Code) {
+		return fmt.Errorf("V4 header code size %04X does not match %04X code words", f.CodeSize, len(f.Code))
+	}
+	if int(f.DataSize) != len(f.Data) {
+		return fmt.Errorf("V4 header data size %04X does not match %04X data words", f.DataSize, len(f.Data))
+	}
+	return nil
+}
+
+// Bytes encodes the file
+func (f *File) Bytes() ([]byte, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	words := []uint16{Magic1, Magic2, f.CodeSize, f.CodeLoadAddress, f.CodeStartAddress, f.DataSize, f.DataLoadAddress}
+	words = append(words, f.Code...)
+	words = append(words, f.Data...)
+	for _, w := range words {
+		b.WriteByte(byte(w >> 8))
+		b.WriteByte(byte(w))
+	}
+	return b.Bytes(), nil
+}
+
+// Write encodes the file to w
+func (f *File) Write(w io.Writer) error {
+	data, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteFile encodes the file to fileName
+func (f *File) WriteFile(fileName string) error {
+	data, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
+
+// Checksum returns the CRC-32 of words (as stored, big endian)
+func Checksum(words []uint16) uint32 {
+	data := make([]byte, 2*len(words))
+	for i, w := range words {
+		data[2*i] = byte(w >> 8)
+		data[2*i+1] = byte(w)
+	}
+	return crc32.ChecksumIEEE(data)
+}
+
+// Inspect prints the header and section checksums
+func (f *File) Inspect(w io.Writer) {
+	fmt.Fprintf(w, "Code Size          [%04X]\n", f.CodeSize)
+	fmt.Fprintf(w, "Code Load Address  [%04X]\n", f.CodeLoadAddress)
+	fmt.Fprintf(w, "Code Start Address [%04X]\n", f.CodeStartAddress)
+	fmt.Fprintf(w, "Code Checksum      [%08X]\n", Checksum(f.Code))
+	fmt.Fprintf(w, "Data Size          [%04X]\n", f.DataSize)
+	fmt.Fprintf(w, "Data Load Address  [%04X]\n", f.DataLoadAddress)
+	fmt.Fprintf(w, "Data Checksum      [%08X]\n", Checksum(f.Data))
+	fmt.Fprintf(w, "File Size          [%08X]\n", f.Size())
+}
+
+// LoadInto writes the code and data to their load addresses
+// and sets the PC to the code start address.
+// Nothing is written unless both sections fit in writable memory.
+func (f *File) LoadInto(m Machine) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if err := m.CheckWritable(uint32(f.CodeLoadAddress), uint32(len(f.Code))); err != nil {
+		return fmt.Errorf("code: %v", err)
+	}
+	if err := m.CheckWritable(uint32(f.DataLoadAddress), uint32(len(f.Data))); err != nil {
+		return fmt.Errorf("data: %v", err)
+	}
+	for i, w := range f.Code {
+		m.Write(uint32(f.CodeLoadAddress)+uint32(i), w)
+	}
+	for i, w := range f.Data {
+		m.Write(uint32(f.DataLoadAddress)+uint32(i), w)
+	}
+	m.SetPC(f.CodeStartAddress)
+	return nil
+}
@@ -0,0 +1,106 @@
+package v4
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testFile returns the bytes of a small valid V4 file
+func testFile() []byte {
+	return []byte{
+		0x00, 0x00, 0x00, 0x04, // magic
+		0x00, 0x02, 0x01, 0x00, 0x01, 0x01, // code size, load, start
+		0x00, 0x01, 0x20, 0x00, // data size, load
+		0x12, 0x34, 0xAB, 0xCD, // code
+		0xFF, 0xEE, // data
+	}
+}
+
+func TestParseWriteRoundTrip(t *testing.T) {
+	data := testFile()
+	f, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := File{
+		Header: Header{CodeSize: 2, CodeLoadAddress: 0x0100, CodeStartAddress: 0x0101, DataSize: 1, DataLoadAddress: 0x2000},
+		Code:   []uint16{0x1234, 0xABCD},
+		Data:   []uint16{0xFFEE},
+	}
+	if !reflect.DeepEqual(*f, want) {
+		t.Fatalf("parsed %+v; want %+v", *f, want)
+	}
+
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), data) {
+		t.Fatalf("wrote % X; want % X", b.Bytes(), data)
+	}
+
+	again, err := Parse(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, f) {
+		t.Fatalf("reparsed %+v; want %+v", *again, *f)
+	}
+}
+
+func TestNewRoundTrip(t *testing.T) {
+	f := New(nil, 0x0100, 0x0100, []uint16{1, 2, 3}, 0x3000)
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != f.Size() {
+		t.Fatalf("wrote %d bytes; header says %d", len(data), f.Size())
+	}
+	again, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.CodeSize != 0 || !reflect.DeepEqual(again.Data, f.Data) || again.DataLoadAddress != 0x3000 {
+		t.Fatalf("reparsed %+v; want %+v", *again, *f)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	good := testFile()
+	badMagic := append([]byte{}, good...)
+	badMagic[3] = 0x05
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"empty", nil, "too small"},
+		{"short header", good[:2*HeaderSize-1], "too small"},
+		{"bad magic", badMagic, "incorrect V4 magic"},
+		{"truncated code", good[:2*HeaderSize+1], "truncated"},
+		{"truncated data", good[:len(good)-1], "truncated"},
+		{"trailing bytes", append(append([]byte{}, good...), 0x00, 0x00), "after the data section"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.data)
+		if err == nil {
+			t.Errorf("%s: parsed without error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %q does not mention %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestBytesRejectsMismatchedHeader(t *testing.T) {
+	f := New([]uint16{1, 2}, 0x0100, 0x0100, nil, 0)
+	f.CodeSize = 3
+	if _, err := f.Bytes(); err == nil {
+		t.Fatalf("header code size 3 with 2 code words encoded without error")
+	}
+}